@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/export"
+	"github.com/jnsgruk/gosherve/pkg/logging"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the configured redirects for use by other servers",
+	Long: fmt.Sprintf(`Export the configured redirects for use by other servers
+
+Loads redirects from the configured source and writes them in the specified
+format. The plain and json formats are those read by gosherve itself. Other
+formats contain the current destination of each active redirect, and features
+which cannot be expressed in the format are reported on stderr.
+
+Supported formats: %s`, strings.Join(export.Formats(), ", ")),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logging.SetupLogger(viper.GetString("log_level"))
+
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		if !slices.Contains(export.Formats(), format) {
+			return fmt.Errorf("unknown format '%s', must be one of: %s", format, strings.Join(export.Formats(), ", "))
+		}
+
+		src, err := redirectSource()
+		if err != nil {
+			return err
+		}
+
+		redirects, err := loadRedirects(src)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+
+		warnings, err := export.Export(w, format, redirects, time.Now())
+		for _, warning := range warnings {
+			slog.Warn(warning.Message, "alias", warning.Alias)
+		}
+		return err
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringP("format", "f", "plain", "format to export redirects in")
+	exportCmd.Flags().StringP("output", "o", "", "file to write to, instead of stdout")
+	rootCmd.AddCommand(exportCmd)
+}
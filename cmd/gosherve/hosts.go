@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/analytics"
+	"github.com/jnsgruk/gosherve/pkg/auth"
+	"github.com/jnsgruk/gosherve/pkg/server"
+	"github.com/jnsgruk/gosherve/pkg/signing"
+
+	"github.com/spf13/viper"
+)
+
+// hostConfig is the configuration of the files and redirects served for a host. When
+// serving a single host it is read from environment variables, otherwise from the
+// hosts file using the same names, without the GOSHERVE_ prefix.
+type hostConfig struct {
+	Host               string `json:"host"`
+	Webroot            string `json:"webroot"`
+	NotFoundPage       string `json:"not_found_page"`
+	DirectoryListing   bool   `json:"directory_listing"`
+	DefaultLanguage    string `json:"default_language"`
+	RedirectMapURL     string `json:"redirect_map_url"`
+	RedirectStore      string `json:"redirect_store"`
+	RedirectGitURL     string `json:"redirect_git_url"`
+	RedirectGitRef     string `json:"redirect_git_ref"`
+	RedirectGitPath    string `json:"redirect_git_path"`
+	RedirectS3Bucket   string `json:"redirect_s3_bucket"`
+	RedirectS3Key      string `json:"redirect_s3_key"`
+	RedirectS3Region   string `json:"redirect_s3_region"`
+	RedirectS3Endpoint string `json:"redirect_s3_endpoint"`
+	RefreshInterval    string `json:"refresh_interval"`
+	BaseURL            string `json:"base_url"`
+	SigningKeys        string `json:"signing_keys"`
+	AnalyticsFile      string `json:"analytics_file"`
+	AnalyticsRetention string `json:"analytics_retention"`
+	TokenFile          string `json:"token_file"`
+}
+
+// defaultAnalyticsRetention is how long click analytics are kept if not configured
+const defaultAnalyticsRetention = 90 * 24 * time.Hour
+
+// envHostConfig returns the host configuration set by environment variables
+func envHostConfig() hostConfig {
+	return hostConfig{
+		Host:               server.DefaultHost,
+		Webroot:            viper.GetString("webroot"),
+		NotFoundPage:       viper.GetString("not_found_page"),
+		DirectoryListing:   viper.GetBool("directory_listing"),
+		DefaultLanguage:    viper.GetString("default_language"),
+		RedirectMapURL:     viper.GetString("redirect_map_url"),
+		RedirectStore:      viper.GetString("redirect_store"),
+		RedirectGitURL:     viper.GetString("redirect_git_url"),
+		RedirectGitRef:     viper.GetString("redirect_git_ref"),
+		RedirectGitPath:    viper.GetString("redirect_git_path"),
+		RedirectS3Bucket:   viper.GetString("redirect_s3_bucket"),
+		RedirectS3Key:      viper.GetString("redirect_s3_key"),
+		RedirectS3Region:   viper.GetString("redirect_s3_region"),
+		RedirectS3Endpoint: viper.GetString("redirect_s3_endpoint"),
+		RefreshInterval:    viper.GetString("refresh_interval"),
+		BaseURL:            viper.GetString("base_url"),
+		SigningKeys:        viper.GetString("signing_keys"),
+		AnalyticsFile:      viper.GetString("analytics_file"),
+		AnalyticsRetention: viper.GetString("analytics_retention"),
+		TokenFile:          viper.GetString("token_file"),
+	}
+}
+
+// tokenStores holds the token stores opened for each token file, by path
+type tokenStores map[string]*auth.TokenStore
+
+// open returns the token store for the file at path, opening it if necessary
+func (t tokenStores) open(path string) (*auth.TokenStore, error) {
+	if store, ok := t[path]; ok {
+		return store, nil
+	}
+	store, err := auth.NewTokenStore(path)
+	if err != nil {
+		return nil, err
+	}
+	t[path] = store
+	return store, nil
+}
+
+// readHostsFile reads the configuration of each host from a JSON file of the form
+// {"hosts": [{"host": "example.com", ...}, ...]}
+func readHostsFile(path string) ([]hostConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Hosts []hostConfig `json:"hosts"`
+	}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing hosts file %s: %w", path, err)
+	}
+	if len(doc.Hosts) == 0 {
+		return nil, fmt.Errorf("no hosts defined in %s", path)
+	}
+	return doc.Hosts, nil
+}
+
+// webroot returns the directory from which files are served, or nil if file serving
+// is disabled
+func (h hostConfig) webroot() *fs.FS {
+	if h.Webroot == "" {
+		return nil
+	}
+	webrootFS := os.DirFS(h.Webroot)
+	return &webrootFS
+}
+
+// source returns the source of redirects for the host. Redirect stores take
+// precedence over git repositories, then S3 buckets, then redirect map URLs.
+func (h hostConfig) source() (server.RedirectSource, error) {
+	if h.RedirectStore != "" {
+		return server.NewFileStore(h.RedirectStore)
+	} else if h.RedirectGitURL != "" {
+		return server.NewGitSource(h.RedirectGitURL, h.RedirectGitRef, valueOr(h.RedirectGitPath, "redirects"))
+	} else if h.RedirectS3Bucket != "" {
+		region := valueOr(h.RedirectS3Region, "us-east-1")
+		endpoint := valueOr(h.RedirectS3Endpoint, fmt.Sprintf("https://s3.%s.amazonaws.com", region))
+		creds := server.S3Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		return server.NewS3Source(endpoint, region, h.RedirectS3Bucket, valueOr(h.RedirectS3Key, "redirects"), creds)
+	} else if h.RedirectMapURL != "" {
+		return server.NewURLSource(h.RedirectMapURL), nil
+	}
+
+	// Application cannot function without a source of redirects.
+	return nil, fmt.Errorf("one of GOSHERVE_REDIRECT_MAP_URL, GOSHERVE_REDIRECT_GIT_URL, GOSHERVE_REDIRECT_S3_BUCKET or GOSHERVE_REDIRECT_STORE environment variables must be set")
+}
+
+// configure applies the host's configuration to a server whose redirects are read
+// from src
+func (h hostConfig) configure(s *server.Server, src server.RedirectSource) error {
+	if h.NotFoundPage != "" {
+		s.ConfigureNotFoundPage(h.NotFoundPage)
+	}
+	s.ConfigureDirectoryListing(h.DirectoryListing)
+	if h.DefaultLanguage != "" {
+		if err := s.ConfigureDefaultLanguage(h.DefaultLanguage); err != nil {
+			return err
+		}
+	}
+
+	err := s.ConfigureBaseURL(h.BaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base url: %w", err)
+	}
+
+	keys, err := signing.ParsePublicKeys(h.SigningKeys)
+	if err != nil {
+		return err
+	}
+	err = s.ConfigureSigningKeys(keys)
+	if err != nil {
+		return err
+	}
+
+	// Poll git repositories for new commits by default
+	var interval time.Duration
+	if h.RefreshInterval != "" {
+		interval, err = time.ParseDuration(h.RefreshInterval)
+		if err != nil {
+			return fmt.Errorf("invalid refresh interval: %w", err)
+		}
+	} else if _, ok := src.(*server.GitSource); ok {
+		interval = time.Minute
+	}
+	s.ConfigureRefreshInterval(interval)
+
+	if h.AnalyticsFile != "" {
+		retention := defaultAnalyticsRetention
+		if h.AnalyticsRetention != "" {
+			retention, err = time.ParseDuration(h.AnalyticsRetention)
+			if err != nil {
+				return fmt.Errorf("invalid analytics retention: %w", err)
+			}
+		}
+		store, err := analytics.NewStore(h.AnalyticsFile, retention)
+		if err != nil {
+			return err
+		}
+		s.ConfigureAnalytics(store)
+	}
+	return nil
+}
+
+// valueOr returns value, or fallback if value is empty
+func valueOr(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
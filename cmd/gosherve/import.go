@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/export"
+	"github.com/jnsgruk/gosherve/pkg/importer"
+	"github.com/jnsgruk/gosherve/pkg/logging"
+	"github.com/jnsgruk/gosherve/pkg/server"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import redirects from other servers' configuration",
+	Long: fmt.Sprintf(`Import redirects from other servers' configuration
+
+Translates the redirect rules in the specified file, or stdin, into gosherve
+redirects, which are written to stdout as a redirects file, or in the format
+of a redirect store. Rules which could not be translated are reported on
+stderr.
+
+Supported formats: %s`, strings.Join(importer.Formats(), ", ")),
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logging.SetupLogger(viper.GetString("log_level"))
+
+		format, _ := cmd.Flags().GetString("format")
+		to, _ := cmd.Flags().GetString("to")
+		if to != "plain" && to != "json" {
+			return fmt.Errorf("unknown output format '%s', must be one of: plain, json", to)
+		}
+
+		var r io.Reader = os.Stdin
+		if len(args) == 1 {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		redirects, problems, err := importer.Import(r, format)
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			slog.Warn(p.Reason, "line", p.Line, "text", p.Text)
+		}
+
+		byAlias := make(map[string]*server.Redirect, len(redirects))
+		for _, rd := range redirects {
+			byAlias[rd.Alias] = rd
+		}
+		_, err = export.Export(os.Stdout, to, byAlias, time.Now())
+		return err
+	},
+}
+
+func init() {
+	importCmd.Flags().StringP("format", "f", "", "format of the redirects to import")
+	importCmd.Flags().String("to", "plain", "format to write redirects in: plain or json")
+	importCmd.MarkFlagRequired("format")
+	rootCmd.AddCommand(importCmd)
+}
@@ -5,9 +5,12 @@ import (
 	"log/slog"
 	"os"
 	"runtime"
+	"strings"
+	"unicode"
 
 	"github.com/jnsgruk/gosherve/pkg/logging"
 	"github.com/jnsgruk/gosherve/pkg/server"
+	"github.com/jnsgruk/gosherve/pkg/signing"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -36,6 +39,15 @@ a url containing alias/URL pairs. For example:
 		something https://somelink.com
 		wow https://www.ohmygoodness.com
 
+Alternatively, 'GOSHERVE_REDIRECT_GIT_URL' can be set to a git repository
+containing a redirects file, 'GOSHERVE_REDIRECT_S3_BUCKET' can be set to an S3
+bucket containing a redirects file, or 'GOSHERVE_REDIRECT_STORE' can be set to
+the path of a local file in which redirects are stored, and managed using the
+admin API.
+
+To serve several domains from one process, 'GOSHERVE_HOSTS_FILE' can be set to
+the path of a JSON file which configures the webroot and redirects of each host.
+
 For more information, visit the homepage at: https://github.com/jnsgruk/gosherve
 `
 
@@ -50,22 +62,27 @@ var rootCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Create a default slog logger with the correct handlers
 		logging.SetupLogger(viper.GetString("log_level"))
+		slog.Info("gosherve", "version", version, "commit", commit, "build_date", date)
 
-		webroot_path := viper.GetString("webroot")
-		webrootFS := os.DirFS(webroot_path)
-		redirect_map_url := viper.GetString("redirect_map_url")
+		if hosts_file := viper.GetString("hosts_file"); hosts_file != "" {
+			return serveVirtualHosts(hosts_file)
+		}
 
-		if redirect_map_url == "" {
-			// Application cannot function without a redirect map url.
-			return fmt.Errorf("GOSHERVE_REDIRECT_MAP_URL environment variable not set")
+		h := envHostConfig()
+		src, err := h.source()
+		if err != nil {
+			return err
 		}
 
 		// Instantiate a new Gosherve server
-		s := server.NewServer(&webrootFS, redirect_map_url)
-		slog.Info("gosherve", "version", version, "commit", commit, "build_date", date)
+		s := server.NewServerWithSource(h.webroot(), src)
+		err = configureServer(s, h, src, tokenStores{})
+		if err != nil {
+			return err
+		}
 
 		// Hydrate the redirects map
-		err := s.RefreshRedirects()
+		err = s.RefreshRedirects()
 		if err != nil {
 			// Since this is the first hydration, exit if unable to fetch redirects.
 			// At this point, without the redirects to begin with the server is
@@ -79,6 +96,79 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// serveVirtualHosts serves each of the hosts configured in the hosts file
+func serveVirtualHosts(path string) error {
+	hosts, err := readHostsFile(path)
+	if err != nil {
+		return err
+	}
+
+	vhosts := server.NewVirtualHosts()
+	tokens := tokenStores{}
+	for _, h := range hosts {
+		src, err := h.source()
+		if err != nil {
+			return fmt.Errorf("host '%s': %w", h.Host, err)
+		}
+		s, err := vhosts.AddHost(h.Host, h.webroot(), src)
+		if err != nil {
+			return err
+		}
+		err = configureServer(s, h, src, tokens)
+		if err != nil {
+			return fmt.Errorf("host '%s': %w", h.Host, err)
+		}
+	}
+
+	// Exit if unable to fetch the redirects of any host, as for a single host
+	err = vhosts.RefreshRedirects()
+	if err != nil {
+		return fmt.Errorf("error fetching redirect map: %w", err)
+	}
+
+	vhosts.Start()
+	return nil
+}
+
+// configureServer applies the configuration shared by all hosts, and then that of the
+// host itself, to a server. Token stores are opened once per file, so that hosts which
+// share a token file also share its store.
+func configureServer(s *server.Server, h hostConfig, src server.RedirectSource, tokens tokenStores) error {
+	err := s.ConfigureShortCodes(viper.GetInt("shortcode_length"), viper.GetString("shortcode_alphabet"))
+	if err != nil {
+		return fmt.Errorf("invalid short code configuration: %w", err)
+	}
+	if path := valueOr(h.TokenFile, viper.GetString("token_file")); path != "" {
+		store, err := tokens.open(path)
+		if err != nil {
+			return err
+		}
+		s.ConfigureTokens(store)
+	}
+	s.ConfigureMetricAliases(viper.GetInt("metrics_max_aliases"), strings.FieldsFunc(viper.GetString("metrics_aliases"), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}))
+	return h.configure(s, src)
+}
+
+// redirectSource returns the source of redirects configured by environment variables
+func redirectSource() (server.RedirectSource, error) {
+	return envHostConfig().source()
+}
+
+// loadRedirects gets the redirects from a source, verifying their signature if
+// signing keys are configured by GOSHERVE_SIGNING_KEYS
+func loadRedirects(src server.RedirectSource) (map[string]*server.Redirect, error) {
+	keys, err := signing.ParsePublicKeys(viper.GetString("signing_keys"))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return src.Redirects()
+	}
+	return server.LoadSignedRedirects(src, keys)
+}
+
 // buildVersion writes a multiline version string from the specified
 // version variables
 func buildVersion(version, commit, date string) string {
@@ -95,7 +185,31 @@ func buildVersion(version, commit, date string) string {
 
 func main() {
 	viper.SetEnvPrefix("gosherve")
+	viper.SetDefault("shortcode_length", server.DefaultShortCodeLength)
+	viper.SetDefault("shortcode_alphabet", server.DefaultShortCodeAlphabet)
 	viper.MustBindEnv("redirect_map_url")
+	viper.BindEnv("redirect_store")
+	viper.BindEnv("redirect_git_url")
+	viper.BindEnv("redirect_git_ref")
+	viper.BindEnv("redirect_git_path")
+	viper.BindEnv("redirect_s3_bucket")
+	viper.BindEnv("redirect_s3_key")
+	viper.BindEnv("redirect_s3_region")
+	viper.BindEnv("redirect_s3_endpoint")
+	viper.BindEnv("refresh_interval")
+	viper.BindEnv("base_url")
+	viper.BindEnv("hosts_file")
+	viper.BindEnv("not_found_page")
+	viper.BindEnv("directory_listing")
+	viper.BindEnv("default_language")
+	viper.BindEnv("shortcode_length")
+	viper.BindEnv("shortcode_alphabet")
+	viper.BindEnv("signing_keys")
+	viper.BindEnv("analytics_file")
+	viper.BindEnv("analytics_retention")
+	viper.BindEnv("metrics_max_aliases")
+	viper.BindEnv("metrics_aliases")
+	viper.BindEnv("token_file")
 	viper.BindEnv("webroot")
 	viper.BindEnv("log_level")
 
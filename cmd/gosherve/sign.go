@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jnsgruk/gosherve/pkg/signing"
+
+	"github.com/spf13/cobra"
+)
+
+var signCmd = &cobra.Command{
+	Use:   "sign [file]",
+	Short: "Sign a redirects file",
+	Long: `Sign a redirects file
+
+Signs the specified redirects file, or stdin, with an ed25519 private key. By
+default a detached signature is written, which should be published alongside
+the redirects file with a '.sig' suffix. With --trailer, the signed redirects
+file is written instead, with the signature embedded on its last line.
+
+Servers only load signed redirects when the public key is included in the
+'GOSHERVE_SIGNING_KEYS' environment variable. A new key is generated with
+--generate-key, and its public key is printed.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keyFile, _ := cmd.Flags().GetString("key")
+		generate, _ := cmd.Flags().GetBool("generate-key")
+		trailer, _ := cmd.Flags().GetBool("trailer")
+		output, _ := cmd.Flags().GetString("output")
+
+		if generate {
+			return generateSigningKey(keyFile)
+		}
+
+		encoded, err := os.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		key, err := signing.ParsePrivateKey(string(encoded))
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", keyFile, err)
+		}
+
+		var r io.Reader = os.Stdin
+		if len(args) == 1 {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		var signed []byte
+		if trailer {
+			signed = signing.AppendTrailer(body, key)
+		} else {
+			signed = []byte(signing.Sign(body, key) + "\n")
+		}
+
+		if output == "" {
+			_, err = os.Stdout.Write(signed)
+			return err
+		}
+		return os.WriteFile(output, signed, 0644)
+	},
+}
+
+// generateSigningKey writes a new private key to the specified file, which must not
+// already exist, and prints its public key
+func generateSigningKey(path string) error {
+	public, private, err := signing.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, signing.EncodePrivateKey(private)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "wrote private key to %s; add the public key to GOSHERVE_SIGNING_KEYS\n", path)
+	fmt.Println(signing.EncodePublicKey(public))
+	return nil
+}
+
+func init() {
+	signCmd.Flags().StringP("key", "k", "", "file containing the private key to sign with")
+	signCmd.Flags().Bool("generate-key", false, "generate a new private key in the key file")
+	signCmd.Flags().Bool("trailer", false, "embed the signature in the redirects file")
+	signCmd.Flags().StringP("output", "o", "", "file to write to, instead of stdout")
+	signCmd.MarkFlagRequired("key")
+	rootCmd.AddCommand(signCmd)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jnsgruk/gosherve/pkg/auth"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens for the admin server",
+	Long: `Manage API tokens for the admin server
+
+Tokens are stored hashed in the file specified by the 'GOSHERVE_TOKEN_FILE'
+environment variable. Changes take effect on a running server immediately.`,
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Mint a new API token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tokens, err := openTokenStore()
+		if err != nil {
+			return err
+		}
+
+		names, _ := cmd.Flags().GetStringSlice("scope")
+		scopes := make([]auth.Scope, len(names))
+		for i, n := range names {
+			scopes[i] = auth.Scope(n)
+		}
+
+		plaintext, token, err := tokens.Mint(args[0], scopes)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "created token %s; it will not be shown again\n", token.ID)
+		fmt.Println(plaintext)
+		return nil
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke an API token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tokens, err := openTokenStore()
+		if err != nil {
+			return err
+		}
+		return tokens.Revoke(args[0])
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API tokens",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tokens, err := openTokenStore()
+		if err != nil {
+			return err
+		}
+
+		list, err := tokens.List()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED")
+		for _, t := range list {
+			scopes := make([]string, len(t.Scopes))
+			for i, s := range t.Scopes {
+				scopes[i] = string(s)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(scopes, ","), t.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+	},
+}
+
+// openTokenStore opens the token store configured by GOSHERVE_TOKEN_FILE
+func openTokenStore() (*auth.TokenStore, error) {
+	path := viper.GetString("token_file")
+	if path == "" {
+		return nil, fmt.Errorf("GOSHERVE_TOKEN_FILE environment variable not set")
+	}
+	return auth.NewTokenStore(path)
+}
+
+func init() {
+	scopes := make([]string, len(auth.Scopes))
+	for i, s := range auth.Scopes {
+		scopes[i] = string(s)
+	}
+
+	tokenCreateCmd.Flags().StringSlice("scope", nil, fmt.Sprintf("scope to grant, may be repeated (one of: %s)", strings.Join(scopes, ", ")))
+	tokenCreateCmd.MarkFlagRequired("scope")
+
+	tokenCmd.AddCommand(tokenCreateCmd, tokenRevokeCmd, tokenListCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
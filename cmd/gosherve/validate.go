@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/logging"
+	"github.com/jnsgruk/gosherve/pkg/server"
+
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate and list the configured redirects",
+	Long: `Validate and list the configured redirects
+
+Loads redirects from the configured source and lists each alias along with
+its current destination and next scheduled change, if any. Lines of the
+redirects file which are invalid are reported on stderr.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Report the reason for skipping any invalid redirects
+		logging.SetupLogger("debug")
+
+		src, err := redirectSource()
+		if err != nil {
+			return err
+		}
+
+		redirects, err := loadRedirects(src)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		aliases := slices.Sorted(maps.Keys(redirects))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ALIAS\tCURRENT\tNEXT")
+		for _, alias := range aliases {
+			r := redirects[alias]
+			fmt.Fprintf(w, "%s\t%s\t%s\n", alias, r.Destination(now), describeNext(r, now))
+		}
+		return w.Flush()
+	},
+}
+
+// describeNext returns a description of the next change to a redirect
+func describeNext(r *server.Redirect, now time.Time) string {
+	var next []string
+	if r.NotBefore != nil && now.Before(*r.NotBefore) {
+		next = append(next, fmt.Sprintf("active from %s", r.NotBefore.Format(time.RFC3339)))
+	}
+	if c := r.NextChange(now); c != nil {
+		next = append(next, fmt.Sprintf("%s from %s", c.URL, c.At.Format(time.RFC3339)))
+	}
+	if r.NotAfter != nil {
+		if now.Before(*r.NotAfter) {
+			next = append(next, fmt.Sprintf("expires %s", r.NotAfter.Format(time.RFC3339)))
+		} else {
+			next = append(next, "expired")
+		}
+	}
+	if len(next) == 0 {
+		return "-"
+	}
+	return strings.Join(next, "; ")
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,332 @@
+// Package analytics records clicks on redirects in hourly buckets, so that the use of
+// each alias can be reported over time. Only the referring host and the class of the
+// client's device are recorded with each click; IP addresses and other details which
+// could identify a visitor are never stored.
+package analytics
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// BucketSize is the period of time over which clicks are aggregated.
+const BucketSize = time.Hour
+
+// maxPoints is the maximum number of points that can be requested in a single series.
+const maxPoints = 10000
+
+// MaxReferrers is the maximum number of distinct referring hosts recorded for an alias
+// in each bucket. Since referrers are sent by clients, clicks from further hosts are
+// counted under OtherReferrer, so that clients cannot grow the store without limit.
+const MaxReferrers = 100
+
+// OtherReferrer is the referrer under which clicks are counted once an alias has
+// MaxReferrers distinct referring hosts in a bucket. It cannot be a hostname.
+const OtherReferrer = "(other)"
+
+// Intervals are the periods that a series can be divided into, by name.
+var Intervals = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+}
+
+// ErrInvalidQuery is returned when a series is requested for an invalid time range.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Click is a single use of a redirect.
+type Click struct {
+	Alias    string
+	Time     time.Time
+	Referrer string
+	Device   string
+}
+
+// Bucket is the number of clicks on an alias from a referring host and device class
+// in the hour beginning at Time. Referrer is empty for clicks without a referrer.
+type Bucket struct {
+	Alias    string    `json:"alias"`
+	Time     time.Time `json:"time"`
+	Referrer string    `json:"referrer,omitempty"`
+	Device   string    `json:"device"`
+	Clicks   uint64    `json:"clicks"`
+}
+
+// bucketKey identifies the bucket that a click is counted in.
+type bucketKey struct {
+	alias    string
+	time     int64
+	referrer string
+	device   string
+}
+
+// hourKey identifies the bucket of an alias, across referrers and devices.
+type hourKey struct {
+	alias string
+	time  int64
+}
+
+// storeFile is the on-disk representation of a Store.
+type storeFile struct {
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Store holds click counts in memory, and persists them to a local JSON file when
+// flushed. Buckets older than the retention period are discarded on each flush.
+type Store struct {
+	mu        sync.Mutex
+	path      string
+	retention time.Duration
+	buckets   map[bucketKey]uint64
+	referrers map[hourKey]map[string]bool
+	dirty     bool
+}
+
+// NewStore returns a Store backed by the file at the specified path, which is created
+// when the store is first flushed. A retention of zero keeps clicks forever.
+func NewStore(path string, retention time.Duration) (*Store, error) {
+	s := &Store{path: path, retention: retention, buckets: map[bucketKey]uint64{}, referrers: map[hourKey]map[string]bool{}}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading analytics file: %w", err)
+	}
+
+	f := storeFile{}
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("error parsing analytics file %s: %w", path, err)
+	}
+	for _, b := range f.Buckets {
+		s.buckets[bucketKey{b.Alias, b.Time.Unix(), b.Referrer, b.Device}] += b.Clicks
+		s.addReferrer(hourKey{b.Alias, b.Time.Unix()}, b.Referrer)
+	}
+	return s, nil
+}
+
+// Record counts a click in the bucket for its hour. Clicks from a referring host which
+// would exceed MaxReferrers for the alias in that hour are counted under OtherReferrer.
+func (s *Store) Record(c Click) {
+	hour := hourKey{c.Alias, c.Time.Truncate(BucketSize).Unix()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	referrer := c.Referrer
+	if referrer != "" && !s.referrers[hour][referrer] {
+		if len(s.referrers[hour]) >= MaxReferrers {
+			referrer = OtherReferrer
+		} else {
+			s.addReferrer(hour, referrer)
+		}
+	}
+
+	s.buckets[bucketKey{hour.alias, hour.time, referrer, c.Device}]++
+	s.dirty = true
+}
+
+// addReferrer records that an alias has clicks from a referring host in a bucket.
+func (s *Store) addReferrer(hour hourKey, referrer string) {
+	if referrer == "" || referrer == OtherReferrer {
+		return
+	}
+	if s.referrers[hour] == nil {
+		s.referrers[hour] = map[string]bool{}
+	}
+	s.referrers[hour][referrer] = true
+}
+
+// Flush discards buckets which have passed the retention period, and writes the
+// store to disk if it has changed since it was last flushed.
+func (s *Store) Flush(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.retention > 0 {
+		cutoff := now.Add(-s.retention).Truncate(BucketSize).Unix()
+		for key := range s.buckets {
+			if key.time < cutoff {
+				delete(s.buckets, key)
+				s.dirty = true
+			}
+		}
+		for hour := range s.referrers {
+			if hour.time < cutoff {
+				delete(s.referrers, hour)
+			}
+		}
+	}
+
+	if !s.dirty {
+		return nil
+	}
+	if err := s.write(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// write atomically replaces the analytics file with the buckets held in memory.
+func (s *Store) write() error {
+	f := storeFile{Buckets: make([]Bucket, 0, len(s.buckets))}
+	for key, clicks := range s.buckets {
+		f.Buckets = append(f.Buckets, Bucket{
+			Alias:    key.alias,
+			Time:     time.Unix(key.time, 0).UTC(),
+			Referrer: key.referrer,
+			Device:   key.device,
+			Clicks:   clicks,
+		})
+	}
+	slices.SortFunc(f.Buckets, func(a, b Bucket) int {
+		return cmp.Or(
+			cmp.Compare(a.Alias, b.Alias),
+			a.Time.Compare(b.Time),
+			cmp.Compare(a.Referrer, b.Referrer),
+			cmp.Compare(a.Device, b.Device),
+		)
+	})
+
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding analytics file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary analytics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing analytics file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing analytics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing analytics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error replacing analytics file: %w", err)
+	}
+	return nil
+}
+
+// Query selects the clicks reported in a Series. Clicks on all aliases are included
+// if Alias is empty. The range is inclusive of From and exclusive of To, which are
+// rounded down and up respectively to a multiple of the Interval, in UTC, so that
+// partial intervals are included. The Interval is the name of one of Intervals.
+type Query struct {
+	Alias    string
+	From     time.Time
+	To       time.Time
+	Interval string
+}
+
+// Point is the number of clicks in the interval beginning at Time.
+type Point struct {
+	Time   time.Time `json:"time"`
+	Clicks uint64    `json:"clicks"`
+}
+
+// Series is the number of clicks in each interval of a time range, along with the
+// total clicks from each referring host and device class over the whole range. Clicks
+// without a referrer are counted under the empty referrer.
+type Series struct {
+	Alias     string            `json:"alias,omitempty"`
+	From      time.Time         `json:"from"`
+	To        time.Time         `json:"to"`
+	Interval  string            `json:"interval"`
+	Total     uint64            `json:"total"`
+	Points    []Point           `json:"points"`
+	Referrers map[string]uint64 `json:"referrers"`
+	Devices   map[string]uint64 `json:"devices"`
+}
+
+// Series returns the clicks matching a query. Intervals without clicks are included
+// in the series with a count of zero.
+func (s *Store) Series(q Query) (*Series, error) {
+	interval, ok := Intervals[q.Interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown interval '%s'", ErrInvalidQuery, q.Interval)
+	}
+	from, to := q.From.UTC().Truncate(interval), roundUp(q.To.UTC(), interval)
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+	n := int(to.Sub(from) / interval)
+	if n > maxPoints {
+		return nil, fmt.Errorf("%w: at most %d intervals may be requested", ErrInvalidQuery, maxPoints)
+	}
+
+	series := &Series{
+		Alias:     q.Alias,
+		From:      from,
+		To:        to,
+		Interval:  q.Interval,
+		Points:    make([]Point, n),
+		Referrers: map[string]uint64{},
+		Devices:   map[string]uint64{},
+	}
+	for i := range series.Points {
+		series.Points[i].Time = from.Add(time.Duration(i) * interval)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, clicks := range s.buckets {
+		if q.Alias != "" && key.alias != q.Alias {
+			continue
+		}
+		t := time.Unix(key.time, 0)
+		if t.Before(from) || !t.Before(to) {
+			continue
+		}
+
+		series.Points[t.Sub(from)/interval].Clicks += clicks
+		series.Total += clicks
+		series.Referrers[key.referrer] += clicks
+		series.Devices[key.device] += clicks
+	}
+	return series, nil
+}
+
+// Totals returns the number of clicks on each alias in a time range, inclusive of
+// from and exclusive of to, which are rounded down and up respectively to a multiple
+// of BucketSize.
+func (s *Store) Totals(from time.Time, to time.Time) map[string]uint64 {
+	from, to = from.Truncate(BucketSize), roundUp(to, BucketSize)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := map[string]uint64{}
+	for key, clicks := range s.buckets {
+		t := time.Unix(key.time, 0)
+		if !t.Before(from) && t.Before(to) {
+			totals[key.alias] += clicks
+		}
+	}
+	return totals
+}
+
+// roundUp returns t rounded up to a multiple of d
+func roundUp(t time.Time, d time.Duration) time.Time {
+	if r := t.Truncate(d); !r.Equal(t) {
+		return r.Add(d)
+	}
+	return t
+}
@@ -0,0 +1,146 @@
+package analytics
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type AnalyticsTestSuite struct {
+	path string
+	now  time.Time
+}
+
+var _ = check.Suite(&AnalyticsTestSuite{})
+
+func (s *AnalyticsTestSuite) SetUpTest(c *check.C) {
+	s.path = path.Join(c.MkDir(), "analytics.json")
+	s.now = time.Date(2026, 3, 2, 12, 30, 0, 0, time.UTC)
+}
+
+// record records n clicks on an alias at the specified offset from the suite's time
+func (s *AnalyticsTestSuite) record(store *Store, alias string, offset time.Duration, referrer string, device string, n int) {
+	for range n {
+		store.Record(Click{Alias: alias, Time: s.now.Add(offset), Referrer: referrer, Device: device})
+	}
+}
+
+// TestSeries tests that clicks are counted in hourly buckets, and reported by interval
+// along with their referrers and devices
+func (s *AnalyticsTestSuite) TestSeries(c *check.C) {
+	store, err := NewStore(s.path, 0)
+	c.Assert(err, check.IsNil)
+
+	s.record(store, "foo", 0, "news.ycombinator.com", "desktop", 3)
+	s.record(store, "foo", 10*time.Minute, "", "ios", 1)
+	s.record(store, "foo", -2*time.Hour, "", "desktop", 2)
+	s.record(store, "bar", 0, "", "android", 5)
+
+	series, err := store.Series(Query{Alias: "foo", From: s.now.Add(-3 * time.Hour), To: s.now, Interval: "hour"})
+	c.Assert(err, check.IsNil)
+	c.Assert(series.From, check.Equals, time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	c.Assert(series.Total, check.Equals, uint64(6))
+	c.Assert(series.Points, check.DeepEquals, []Point{
+		{Time: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC), Clicks: 0},
+		{Time: time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC), Clicks: 2},
+		{Time: time.Date(2026, 3, 2, 11, 0, 0, 0, time.UTC), Clicks: 0},
+		{Time: time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC), Clicks: 4},
+	})
+	c.Assert(series.Referrers, check.DeepEquals, map[string]uint64{"news.ycombinator.com": 3, "": 3})
+	c.Assert(series.Devices, check.DeepEquals, map[string]uint64{"desktop": 5, "ios": 1})
+
+	// All aliases are included if none is specified
+	series, err = store.Series(Query{From: s.now.Add(-24 * time.Hour), To: s.now, Interval: "day"})
+	c.Assert(err, check.IsNil)
+	c.Assert(series.Points, check.DeepEquals, []Point{
+		{Time: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), Clicks: 0},
+		{Time: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), Clicks: 11},
+	})
+
+	c.Assert(store.Totals(s.now.Add(-time.Hour), s.now), check.DeepEquals, map[string]uint64{"foo": 4, "bar": 5})
+	c.Assert(store.Totals(s.now.Add(-3*time.Hour), s.now.Add(-time.Hour)), check.DeepEquals, map[string]uint64{"foo": 2})
+}
+
+// TestReferrerLimit tests that clicks from referring hosts beyond the limit for an
+// alias in each bucket are counted under OtherReferrer
+func (s *AnalyticsTestSuite) TestReferrerLimit(c *check.C) {
+	store, err := NewStore(s.path, 0)
+	c.Assert(err, check.IsNil)
+
+	for i := range MaxReferrers + 10 {
+		s.record(store, "foo", 0, fmt.Sprintf("%d.example.com", i), "desktop", 1)
+	}
+	// Known referrers, and clicks without a referrer, are still counted separately
+	s.record(store, "foo", 0, "0.example.com", "ios", 1)
+	s.record(store, "foo", 0, "", "desktop", 1)
+	// The limit applies to each alias and bucket
+	s.record(store, "bar", 0, "new.example.com", "desktop", 1)
+	s.record(store, "foo", time.Hour, "new.example.com", "desktop", 1)
+
+	series, err := store.Series(Query{Alias: "foo", From: s.now, To: s.now, Interval: "hour"})
+	c.Assert(err, check.IsNil)
+	c.Assert(series.Referrers, check.HasLen, MaxReferrers+2)
+	c.Assert(series.Referrers[OtherReferrer], check.Equals, uint64(10))
+	c.Assert(series.Referrers["0.example.com"], check.Equals, uint64(2))
+	c.Assert(series.Referrers[""], check.Equals, uint64(1))
+
+	series, err = store.Series(Query{From: s.now, To: s.now.Add(2 * time.Hour), Interval: "hour"})
+	c.Assert(err, check.IsNil)
+	c.Assert(series.Referrers["new.example.com"], check.Equals, uint64(2))
+
+	// The referrers of persisted buckets count towards the limit once reloaded
+	c.Assert(store.Flush(s.now), check.IsNil)
+	store, err = NewStore(s.path, 0)
+	c.Assert(err, check.IsNil)
+	s.record(store, "foo", 0, "another.example.com", "desktop", 1)
+	series, err = store.Series(Query{Alias: "foo", From: s.now, To: s.now, Interval: "hour"})
+	c.Assert(err, check.IsNil)
+	c.Assert(series.Referrers[OtherReferrer], check.Equals, uint64(11))
+}
+
+// TestSeriesInvalid tests that invalid queries are rejected
+func (s *AnalyticsTestSuite) TestSeriesInvalid(c *check.C) {
+	store, err := NewStore(s.path, 0)
+	c.Assert(err, check.IsNil)
+
+	_, err = store.Series(Query{From: s.now, To: s.now.Add(time.Hour), Interval: "week"})
+	c.Assert(err, check.ErrorMatches, "invalid query: unknown interval 'week'")
+	_, err = store.Series(Query{From: s.now.Add(time.Hour), To: s.now, Interval: "hour"})
+	c.Assert(err, check.ErrorMatches, "invalid query: from must be before to")
+	_, err = store.Series(Query{From: s.now.AddDate(-5, 0, 0), To: s.now, Interval: "hour"})
+	c.Assert(err, check.ErrorMatches, "invalid query: at most 10000 intervals may be requested")
+}
+
+// TestPersistence tests that clicks are persisted when flushed, and that buckets older
+// than the retention period are discarded
+func (s *AnalyticsTestSuite) TestPersistence(c *check.C) {
+	store, err := NewStore(s.path, 48*time.Hour)
+	c.Assert(err, check.IsNil)
+
+	// Nothing is written until there are clicks
+	c.Assert(store.Flush(s.now), check.IsNil)
+	_, err = os.Stat(s.path)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+
+	s.record(store, "foo", 0, "", "desktop", 2)
+	s.record(store, "foo", -72*time.Hour, "", "desktop", 1)
+	c.Assert(store.Flush(s.now), check.IsNil)
+
+	store, err = NewStore(s.path, 48*time.Hour)
+	c.Assert(err, check.IsNil)
+	c.Assert(store.Totals(s.now.AddDate(0, 0, -7), s.now), check.DeepEquals, map[string]uint64{"foo": 2})
+
+	// Clicks recorded after reloading are added to the persisted buckets
+	s.record(store, "foo", 0, "", "desktop", 1)
+	c.Assert(store.Totals(s.now, s.now), check.DeepEquals, map[string]uint64{"foo": 3})
+
+	c.Assert(os.WriteFile(s.path, []byte("nope"), 0644), check.IsNil)
+	_, err = NewStore(s.path, 0)
+	c.Assert(err, check.ErrorMatches, "error parsing analytics file .*")
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/jnsgruk/gosherve/pkg/logging"
+)
+
+type ctxKey string
+
+const ctxTokenKey ctxKey = "token"
+
+// GetTokenFromCtx returns the token which authenticated a request, if any
+func GetTokenFromCtx(ctx context.Context) (*Token, bool) {
+	t, ok := ctx.Value(ctxTokenKey).(*Token)
+	return t, ok
+}
+
+// RequireScope is a middleware that only calls the next handler if the request
+// carries a bearer token which has been granted the specified scope. All decisions
+// are written to the audit log along with the identity of the caller.
+func RequireScope(tokens *TokenStore, scope Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := logging.GetLoggerFromCtx(r.Context())
+
+		plaintext, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			l.Warn("unauthenticated request", slog.Group("auth", "scope", scope))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gosherve"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := tokens.Authenticate(plaintext)
+		if err != nil {
+			l.Warn("invalid token", slog.Group("auth", "scope", scope, "error", err.Error()))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gosherve", error="invalid_token"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ag := slog.Group("auth", "token_id", token.ID, "token_name", token.Name, "scope", scope)
+		if !token.HasScope(scope) {
+			l.Warn("forbidden", ag)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		l = l.With(ag)
+		l.Info("authorized request")
+
+		ctx := context.WithValue(r.Context(), ctxTokenKey, token)
+		ctx = logging.WithLogger(ctx, l)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
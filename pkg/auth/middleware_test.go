@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+type MiddlewareTestSuite struct {
+	tokens  *TokenStore
+	handler http.Handler
+	logs    *bytes.Buffer
+}
+
+func (s *MiddlewareTestSuite) SetUpTest(c *check.C) {
+	s.tokens, _ = NewTokenStore(path.Join(c.MkDir(), "tokens.json"))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := GetTokenFromCtx(r.Context())
+		c.Assert(ok, check.Equals, true)
+		w.Write([]byte(token.Name))
+	})
+	s.handler = RequireScope(s.tokens, ScopeLinksWrite, next)
+
+	s.logs = &bytes.Buffer{}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(s.logs, nil)))
+}
+
+var _ = check.Suite(&MiddlewareTestSuite{})
+
+// request makes a request to the test handler with the specified Authorization header
+func (s *MiddlewareTestSuite) request(authorization string) (string, int) {
+	req := httptest.NewRequest("POST", "/", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, req)
+	return strings.TrimSpace(rr.Body.String()), rr.Code
+}
+
+// TestRequireScopeAuthorized tests that a token with the right scope is allowed
+// through, and that the caller is recorded in the audit log.
+func (s *MiddlewareTestSuite) TestRequireScopeAuthorized(c *check.C) {
+	plaintext, token, _ := s.tokens.Mint("ci", []Scope{ScopeLinksWrite})
+
+	body, code := s.request("Bearer " + plaintext)
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Equals, "ci")
+	c.Assert(s.logs.String(), check.Matches, `(?s).*"msg":"authorized request","auth":\{"token_id":"`+token.ID+`","token_name":"ci","scope":"links:write"\}.*`)
+}
+
+// TestRequireScopeForbidden tests that a valid token without the scope is rejected
+func (s *MiddlewareTestSuite) TestRequireScopeForbidden(c *check.C) {
+	plaintext, _, _ := s.tokens.Mint("ci", []Scope{ScopeLinksRead})
+
+	body, code := s.request("Bearer " + plaintext)
+	c.Assert(code, check.Equals, http.StatusForbidden)
+	c.Assert(body, check.Equals, "Forbidden")
+	c.Assert(s.logs.String(), check.Matches, `(?s).*"msg":"forbidden".*"token_name":"ci".*`)
+}
+
+// TestRequireScopeUnauthorized tests that missing and invalid tokens are rejected
+func (s *MiddlewareTestSuite) TestRequireScopeUnauthorized(c *check.C) {
+	for _, a := range []string{"", "Basic Zm9vOmJhcg==", "Bearer gsh_nope_nope"} {
+		body, code := s.request(a)
+		c.Assert(code, check.Equals, http.StatusUnauthorized)
+		c.Assert(body, check.Equals, "Unauthorized")
+	}
+}
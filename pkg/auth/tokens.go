@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope grants a token access to a class of admin operations.
+type Scope string
+
+const (
+	ScopeLinksRead  Scope = "links:read"
+	ScopeLinksWrite Scope = "links:write"
+	ScopeReload     Scope = "reload"
+	ScopeMetrics    Scope = "metrics"
+	ScopeAnalytics  Scope = "analytics:read"
+)
+
+// Scopes is the list of all valid scopes.
+var Scopes = []Scope{ScopeLinksRead, ScopeLinksWrite, ScopeReload, ScopeMetrics, ScopeAnalytics}
+
+// tokenPrefix is prepended to all minted tokens so that they are easy to identify.
+const tokenPrefix = "gsh"
+
+var (
+	// ErrInvalidToken is returned when a token is malformed, unknown or revoked.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenNotFound is returned when revoking a token ID that does not exist.
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// Token is an API token. Only a hash of the token's secret is stored.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []Scope   `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HasScope reports whether the token has been granted the specified scope.
+func (t *Token) HasScope(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// tokenFile is the on-disk representation of a TokenStore.
+type tokenFile struct {
+	Tokens []*Token `json:"tokens"`
+}
+
+// TokenStore manages API tokens persisted in a local JSON file. The file is
+// reloaded when it changes on disk, so tokens minted or revoked by another
+// process take effect without a restart.
+type TokenStore struct {
+	mu     sync.Mutex
+	path   string
+	loaded os.FileInfo
+	tokens map[string]*Token
+}
+
+// NewTokenStore returns a TokenStore backed by the file at the specified path.
+// If the file does not exist it is created when the first token is minted.
+func NewTokenStore(path string) (*TokenStore, error) {
+	t := &TokenStore{path: path, tokens: map[string]*Token{}}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Mint creates a new token with the specified name and scopes, returning the
+// plaintext token which must be given to the client. It cannot be recovered later.
+func (t *TokenStore) Mint(name string, scopes []Scope) (string, *Token, error) {
+	for _, s := range scopes {
+		if !slices.Contains(Scopes, s) {
+			return "", nil, fmt.Errorf("unknown scope '%s'", s)
+		}
+	}
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("at least one scope must be specified")
+	}
+
+	id, err := randomString(6)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := &Token{
+		ID:        id,
+		Name:      name,
+		Hash:      hashSecret(secret),
+		Scopes:    slices.Clone(scopes),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.load(); err != nil {
+		return "", nil, err
+	}
+	t.tokens[id] = token
+	if err := t.write(); err != nil {
+		delete(t.tokens, id)
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("%s_%s_%s", tokenPrefix, id, secret), token, nil
+}
+
+// Revoke removes the token with the specified ID.
+func (t *TokenStore) Revoke(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.load(); err != nil {
+		return err
+	}
+	token, exists := t.tokens[id]
+	if !exists {
+		return ErrTokenNotFound
+	}
+	delete(t.tokens, id)
+	if err := t.write(); err != nil {
+		t.tokens[id] = token
+		return err
+	}
+	return nil
+}
+
+// List returns all tokens, sorted by creation time.
+func (t *TokenStore) List() ([]*Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	tokens := make([]*Token, 0, len(t.tokens))
+	for _, token := range t.tokens {
+		tokens = append(tokens, token)
+	}
+	slices.SortFunc(tokens, func(a, b *Token) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return tokens, nil
+}
+
+// Authenticate returns the token matching the specified plaintext token.
+func (t *TokenStore) Authenticate(plaintext string) (*Token, error) {
+	parts := strings.Split(plaintext, "_")
+	if len(parts) != 3 || parts[0] != tokenPrefix {
+		return nil, ErrInvalidToken
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+
+	token, exists := t.tokens[parts[1]]
+	if !exists {
+		return nil, ErrInvalidToken
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashSecret(parts[2]))) != 1 {
+		return nil, ErrInvalidToken
+	}
+	return token, nil
+}
+
+// load reads the token file if it has changed since it was last read.
+func (t *TokenStore) load() error {
+	fi, err := os.Stat(t.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.tokens = map[string]*Token{}
+		t.loaded = nil
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading token file: %w", err)
+	}
+
+	// The file is always replaced by renaming, so a change of inode as well as
+	// modification time indicates that it has been rewritten.
+	if t.loaded != nil && os.SameFile(fi, t.loaded) && fi.ModTime().Equal(t.loaded.ModTime()) {
+		return nil
+	}
+
+	content, err := os.ReadFile(t.path)
+	if err != nil {
+		return fmt.Errorf("error reading token file: %w", err)
+	}
+
+	f := tokenFile{}
+	if err := json.Unmarshal(content, &f); err != nil {
+		return fmt.Errorf("error parsing token file %s: %w", t.path, err)
+	}
+
+	t.tokens = map[string]*Token{}
+	for _, token := range f.Tokens {
+		t.tokens[token.ID] = token
+	}
+	t.loaded = fi
+	return nil
+}
+
+// write atomically replaces the token file with the tokens held in memory.
+func (t *TokenStore) write() error {
+	f := tokenFile{Tokens: make([]*Token, 0, len(t.tokens))}
+	for _, token := range t.tokens {
+		f.Tokens = append(f.Tokens, token)
+	}
+	slices.SortFunc(f.Tokens, func(a, b *Token) int { return strings.Compare(a.ID, b.ID) })
+
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding token file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary token file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// Token hashes are sensitive, so restrict the file to its owner.
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing token file: %w", err)
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing token file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing token file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		return fmt.Errorf("error replacing token file: %w", err)
+	}
+
+	if fi, err := os.Stat(t.path); err == nil {
+		t.loaded = fi
+	}
+	return nil
+}
+
+// randomString returns a hex encoded string of n random bytes.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashSecret returns the hex encoded SHA-256 hash of a token secret. Secrets are
+// high entropy random values, so a fast hash is sufficient.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { check.TestingT(t) }
+
+type TokensTestSuite struct {
+	path   string
+	tokens *TokenStore
+}
+
+func (s *TokensTestSuite) SetUpTest(c *check.C) {
+	s.path = path.Join(c.MkDir(), "tokens.json")
+	s.tokens, _ = NewTokenStore(s.path)
+}
+
+var _ = check.Suite(&TokensTestSuite{})
+
+// TestMintAndAuthenticate tests that a minted token can be used to authenticate,
+// and that only its hash is written to disk.
+func (s *TokensTestSuite) TestMintAndAuthenticate(c *check.C) {
+	plaintext, token, err := s.tokens.Mint("ci", []Scope{ScopeLinksRead})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.Name, check.Equals, "ci")
+
+	authed, err := s.tokens.Authenticate(plaintext)
+	c.Assert(err, check.IsNil)
+	c.Assert(authed.ID, check.Equals, token.ID)
+	c.Assert(authed.HasScope(ScopeLinksRead), check.Equals, true)
+	c.Assert(authed.HasScope(ScopeLinksWrite), check.Equals, false)
+
+	content, _ := os.ReadFile(s.path)
+	c.Assert(string(content), check.Not(check.Matches), "(?s).*"+plaintext[len(plaintext)-64:]+".*")
+
+	fi, _ := os.Stat(s.path)
+	c.Assert(fi.Mode().Perm(), check.Equals, os.FileMode(0600))
+}
+
+// TestMintInvalidScopes tests that tokens cannot be minted with unknown or no scopes
+func (s *TokensTestSuite) TestMintInvalidScopes(c *check.C) {
+	_, _, err := s.tokens.Mint("ci", []Scope{"everything"})
+	c.Assert(err, check.ErrorMatches, "unknown scope 'everything'")
+
+	_, _, err = s.tokens.Mint("ci", nil)
+	c.Assert(err, check.ErrorMatches, "at least one scope must be specified")
+}
+
+// TestAuthenticateInvalid tests that malformed and incorrect tokens are rejected
+func (s *TokensTestSuite) TestAuthenticateInvalid(c *check.C) {
+	plaintext, token, _ := s.tokens.Mint("ci", []Scope{ScopeLinksRead})
+
+	for _, t := range []string{"", "garbage", "gsh_" + token.ID + "_wrong", "xyz" + plaintext[3:], plaintext + "_extra"} {
+		_, err := s.tokens.Authenticate(t)
+		c.Assert(err, check.Equals, ErrInvalidToken)
+	}
+}
+
+// TestRevoke tests that a revoked token can no longer authenticate
+func (s *TokensTestSuite) TestRevoke(c *check.C) {
+	plaintext, token, _ := s.tokens.Mint("ci", []Scope{ScopeLinksRead})
+
+	c.Assert(s.tokens.Revoke(token.ID), check.IsNil)
+	_, err := s.tokens.Authenticate(plaintext)
+	c.Assert(err, check.Equals, ErrInvalidToken)
+
+	c.Assert(s.tokens.Revoke(token.ID), check.Equals, ErrTokenNotFound)
+}
+
+// TestReloadFromDisk tests that changes made by another TokenStore on the same file,
+// such as the CLI, are picked up without restarting.
+func (s *TokensTestSuite) TestReloadFromDisk(c *check.C) {
+	other, err := NewTokenStore(s.path)
+	c.Assert(err, check.IsNil)
+
+	plaintext, token, _ := other.Mint("cli", []Scope{ScopeReload})
+	authed, err := s.tokens.Authenticate(plaintext)
+	c.Assert(err, check.IsNil)
+	c.Assert(authed.Name, check.Equals, "cli")
+
+	other.Revoke(token.ID)
+	_, err = s.tokens.Authenticate(plaintext)
+	c.Assert(err, check.Equals, ErrInvalidToken)
+
+	list, _ := s.tokens.List()
+	c.Assert(list, check.HasLen, 0)
+}
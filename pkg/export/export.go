@@ -0,0 +1,224 @@
+// Package export writes gosherve redirects in the formats used by other web servers
+// and hosting platforms, so that a redirect map can be reused elsewhere.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/server"
+)
+
+// Features of a redirect which only some formats can express.
+const (
+	featureExpiry    = "expiry"
+	featureSchedule  = "schedule"
+	featureVariants  = "variants"
+	featureDevices   = "device specific destinations"
+	featureLanguages = "language specific destinations"
+)
+
+// Warning describes a feature of a redirect which could not be expressed in the
+// exported format.
+type Warning struct {
+	Alias   string
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Alias, w.Message)
+}
+
+// format writes redirects in a particular format. Formats which cannot express all
+// features of a redirect write its current destination, and list the features that
+// they do support.
+type format struct {
+	write    func(w io.Writer, redirects []*server.Redirect, now time.Time) error
+	lossless bool
+	supports []string
+}
+
+var formats = map[string]format{
+	"plain":   {write: writePlain, lossless: true},
+	"json":    {write: writeJSON, lossless: true},
+	"csv":     {write: writeCSV},
+	"netlify": {write: writeNetlify, supports: []string{featureLanguages}},
+	"nginx":   {write: writeNginx},
+	"apache":  {write: writeApache},
+	"caddy":   {write: writeCaddy},
+}
+
+// Formats returns the names of the supported export formats.
+func Formats() []string {
+	return slices.Sorted(maps.Keys(formats))
+}
+
+// Export writes redirects to w in the named format, returning warnings for features of
+// redirects that the format cannot express. Redirects are written in order of alias.
+// For formats which can only express a redirect's current destination, redirects which
+// are not active at the specified time, password protected or limited-use are skipped.
+func Export(w io.Writer, name string, redirects map[string]*server.Redirect, now time.Time) ([]Warning, error) {
+	f, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format '%s', must be one of: %s", name, strings.Join(Formats(), ", "))
+	}
+
+	var warnings []Warning
+	var included []*server.Redirect
+	for _, alias := range slices.Sorted(maps.Keys(redirects)) {
+		r := redirects[alias]
+		if f.lossless {
+			included = append(included, r)
+			continue
+		}
+
+		if r.NotBefore != nil && now.Before(*r.NotBefore) || r.NotAfter != nil && !now.Before(*r.NotAfter) {
+			warnings = append(warnings, Warning{alias, "not active, skipped"})
+			continue
+		}
+		// Writing these as open redirects would publish protected destinations, and
+		// allow limited-use redirects to be followed without limit
+		if r.PasswordHash != "" {
+			warnings = append(warnings, Warning{alias, "password protected, skipped"})
+			continue
+		}
+		if r.MaxClicks > 0 {
+			warnings = append(warnings, Warning{alias, "click limited, skipped"})
+			continue
+		}
+		for _, feature := range features(r) {
+			if !slices.Contains(f.supports, feature) {
+				warnings = append(warnings, Warning{alias, fmt.Sprintf("%s cannot be expressed in %s format", feature, name)})
+			}
+		}
+		included = append(included, r)
+	}
+
+	return warnings, f.write(w, included, now)
+}
+
+// features returns the features of a redirect which only some formats can express.
+func features(r *server.Redirect) []string {
+	var fs []string
+	if r.NotAfter != nil {
+		fs = append(fs, featureExpiry)
+	}
+	if len(r.Schedule) > 0 {
+		fs = append(fs, featureSchedule)
+	}
+	if len(r.Variants) > 0 {
+		fs = append(fs, featureVariants)
+	}
+	if len(r.Devices) > 0 {
+		fs = append(fs, featureDevices)
+	}
+	if len(r.Languages) > 0 {
+		fs = append(fs, featureLanguages)
+	}
+	return fs
+}
+
+// status returns the HTTP status code with which gosherve would serve a redirect.
+func status(r *server.Redirect) int {
+	if r.Dynamic() {
+		return 302
+	}
+	return 301
+}
+
+// writePlain writes redirects in the gosherve redirects file format.
+func writePlain(w io.Writer, redirects []*server.Redirect, now time.Time) error {
+	for _, r := range redirects {
+		if _, err := fmt.Fprintln(w, r.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSON writes redirects in the format of a gosherve redirect store.
+func writeJSON(w io.Writer, redirects []*server.Redirect, now time.Time) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string][]*server.Redirect{"redirects": redirects})
+}
+
+// writeCSV writes the current destination of each redirect as CSV.
+func writeCSV(w io.Writer, redirects []*server.Redirect, now time.Time) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"alias", "url", "status", "description"})
+	for _, r := range redirects {
+		cw.Write([]string{r.Alias, r.Destination(now), fmt.Sprint(status(r)), r.Description})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeNetlify writes redirects in the format of a Netlify _redirects file. Language
+// specific destinations are written as rules conditioned on the Language header, which
+// precede the rule for the redirect's destination, since Netlify uses the first match.
+func writeNetlify(w io.Writer, redirects []*server.Redirect, now time.Time) error {
+	for _, r := range redirects {
+		for _, tag := range slices.Sorted(maps.Keys(r.Languages)) {
+			fmt.Fprintf(w, "/%s  %s  302  Language=%s\n", r.Alias, r.Languages[tag], tag)
+		}
+		if _, err := fmt.Fprintf(w, "/%s  %s  %d\n", r.Alias, r.Destination(now), status(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNginx writes redirects as an nginx map from request path to destination. Since
+// an nginx map has a single value, every redirect is served with the same status code.
+func writeNginx(w io.Writer, redirects []*server.Redirect, now time.Time) error {
+	fmt.Fprintln(w, "# Include in the http block, and redirect from a server block with:")
+	fmt.Fprintln(w, "#   if ($gosherve_redirect) { return 302 $gosherve_redirect; }")
+	fmt.Fprintln(w, "map $uri $gosherve_redirect {")
+	for _, r := range redirects {
+		fmt.Fprintf(w, "    %s %s;\n", nginxQuote("/"+r.Alias), nginxQuote(r.Destination(now)))
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// nginxQuote quotes a string for use in an nginx configuration file.
+func nginxQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(s) + `"`
+}
+
+// apacheSubstitution matches characters with special meaning in the substitution of
+// an Apache RewriteRule.
+var apacheSubstitution = regexp.MustCompile(`[$%\\]`)
+
+// writeApache writes redirects as Apache mod_rewrite rules.
+func writeApache(w io.Writer, redirects []*server.Redirect, now time.Time) error {
+	fmt.Fprintln(w, "RewriteEngine On")
+	for _, r := range redirects {
+		dest := apacheSubstitution.ReplaceAllString(r.Destination(now), `\$0`)
+		fmt.Fprintf(w, "RewriteRule ^/?%s/?$ %s [R=%d,NE,L]\n", regexp.QuoteMeta(r.Alias), dest, status(r))
+	}
+	return nil
+}
+
+// writeCaddy writes redirects as Caddyfile redir directives.
+func writeCaddy(w io.Writer, redirects []*server.Redirect, now time.Time) error {
+	fmt.Fprintln(w, "# Include in a site block")
+	for _, r := range redirects {
+		fmt.Fprintf(w, "redir /%s %s %d\n", r.Alias, caddyQuote(r.Destination(now)), status(r))
+	}
+	return nil
+}
+
+// caddyQuote quotes a string for use in a Caddyfile, escaping braces so that they are
+// not interpreted as placeholders.
+func caddyQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `{`, `\{`, `}`, `\}`).Replace(s) + `"`
+}
@@ -0,0 +1,131 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/server"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type ExportTestSuite struct {
+	redirects map[string]*server.Redirect
+	now       time.Time
+}
+
+var _ = check.Suite(&ExportTestSuite{})
+
+func (s *ExportTestSuite) SetUpTest(c *check.C) {
+	s.now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := s.now.Add(time.Hour)
+	earlier := s.now.Add(-time.Hour)
+
+	s.redirects = map[string]*server.Redirect{
+		"foo":  {Alias: "foo", URL: "http://foo.bar", Description: "Foo, the bar"},
+		"docs": {Alias: "docs", URL: "http://docs.com/en", Languages: map[string]string{"de": "http://docs.com/de"}},
+		"new":  {Alias: "new", URL: "http://new.com", NotBefore: &later},
+		"old":  {Alias: "old", URL: "http://old.com", NotAfter: &earlier},
+		"vpn":  {Alias: "vpn", URL: "http://vpn.com", PasswordHash: "$2a$04$abcdefghijklmnopqrstuu5Wc9vDdVvH7Gl6wWFnIsfO1oq3dg.C2"},
+		"once": {Alias: "once", URL: "http://once.com", MaxClicks: 1, Clicks: 1},
+		"talk": {Alias: "talk", URL: "http://a.com", Schedule: []server.ScheduledURL{{At: earlier, URL: "http://b.com?q=$1%20"}}},
+	}
+}
+
+// export exports the suite's redirects in the named format
+func (s *ExportTestSuite) export(c *check.C, format string) (string, []string) {
+	var buf bytes.Buffer
+	warnings, err := Export(&buf, format, s.redirects, s.now)
+	c.Assert(err, check.IsNil)
+
+	messages := make([]string, len(warnings))
+	for i, w := range warnings {
+		messages[i] = w.String()
+	}
+	return buf.String(), messages
+}
+
+// TestExportPlain tests that the plain format includes every redirect and attribute
+func (s *ExportTestSuite) TestExportPlain(c *check.C) {
+	out, warnings := s.export(c, "plain")
+
+	c.Assert(warnings, check.HasLen, 0)
+	c.Assert(out, check.Equals, `docs http://docs.com/en lang=de,http://docs.com/de
+foo http://foo.bar description=Foo%2C+the+bar
+new http://new.com not_before=2026-01-01T01:00:00Z
+old http://old.com not_after=2025-12-31T23:00:00Z
+once http://once.com max_clicks=1 clicks=1
+talk http://a.com schedule=2025-12-31T23:00:00Z,http://b.com?q=$1%20
+vpn http://vpn.com password=$2a$04$abcdefghijklmnopqrstuu5Wc9vDdVvH7Gl6wWFnIsfO1oq3dg.C2
+`)
+}
+
+// TestExportJSON tests that the json format is a redirect store document
+func (s *ExportTestSuite) TestExportJSON(c *check.C) {
+	out, warnings := s.export(c, "json")
+
+	c.Assert(warnings, check.HasLen, 0)
+	c.Assert(out, check.Matches, `(?s)\{\n  "redirects": \[\n    \{\n      "alias": "docs",.*`)
+}
+
+// TestExportCSV tests that the csv format contains current destinations
+func (s *ExportTestSuite) TestExportCSV(c *check.C) {
+	out, warnings := s.export(c, "csv")
+
+	c.Assert(out, check.Equals, `alias,url,status,description
+docs,http://docs.com/en,302,
+foo,http://foo.bar,301,"Foo, the bar"
+talk,http://b.com?q=$1%20,302,
+`)
+	c.Assert(warnings, check.DeepEquals, []string{
+		"docs: language specific destinations cannot be expressed in csv format",
+		"new: not active, skipped",
+		"old: not active, skipped",
+		"once: click limited, skipped",
+		"talk: schedule cannot be expressed in csv format",
+		"vpn: password protected, skipped",
+	})
+}
+
+// TestExportNetlify tests that the netlify format expresses language specific destinations
+func (s *ExportTestSuite) TestExportNetlify(c *check.C) {
+	out, warnings := s.export(c, "netlify")
+
+	c.Assert(out, check.Equals, `/docs  http://docs.com/de  302  Language=de
+/docs  http://docs.com/en  302
+/foo  http://foo.bar  301
+/talk  http://b.com?q=$1%20  302
+`)
+	c.Assert(warnings, check.DeepEquals, []string{
+		"new: not active, skipped",
+		"old: not active, skipped",
+		"once: click limited, skipped",
+		"talk: schedule cannot be expressed in netlify format",
+		"vpn: password protected, skipped",
+	})
+}
+
+// TestExportServers tests the nginx, apache and caddy formats, including escaping of
+// characters which are special to each server
+func (s *ExportTestSuite) TestExportServers(c *check.C) {
+	s.redirects = map[string]*server.Redirect{
+		"a.b": {Alias: "a.b", URL: `http://a.com/"$x"?q=%20&r={y}`},
+	}
+
+	out, _ := s.export(c, "nginx")
+	c.Assert(out, check.Matches, `(?s).*map \$uri \$gosherve_redirect \{\n    "/a.b" "http://a.com/\\"\\\$x\\"\?q=%20&r=\{y\}";\n\}\n`)
+
+	out, _ = s.export(c, "apache")
+	c.Assert(out, check.Equals, "RewriteEngine On\nRewriteRule ^/?a\\.b/?$ http://a.com/\"\\$x\"?q=\\%20&r={y} [R=301,NE,L]\n")
+
+	out, _ = s.export(c, "caddy")
+	c.Assert(out, check.Equals, "# Include in a site block\nredir /a.b \"http://a.com/\\\"$x\\\"?q=%20&r=\\{y\\}\" 301\n")
+}
+
+// TestExportUnknownFormat tests that unknown formats are rejected
+func (s *ExportTestSuite) TestExportUnknownFormat(c *check.C) {
+	_, err := Export(&bytes.Buffer{}, "htaccess", s.redirects, s.now)
+	c.Assert(err, check.ErrorMatches, "unknown format 'htaccess', must be one of: apache, caddy, csv, json, netlify, nginx, plain")
+}
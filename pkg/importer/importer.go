@@ -0,0 +1,411 @@
+// Package importer translates the redirect rules of other web servers and hosting
+// platforms into gosherve redirects, to ease migrating an existing site.
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jnsgruk/gosherve/pkg/server"
+)
+
+// Problem describes a line of a redirect map which could not be translated, or which
+// could only be translated in part.
+type Problem struct {
+	Line   int
+	Text   string
+	Reason string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d: %s: %s", p.Line, p.Reason, p.Text)
+}
+
+// importer holds the state of an import in progress.
+type importer struct {
+	redirects map[string]*server.Redirect
+	problems  []Problem
+	// provisional holds problems for redirects whose default destination has not
+	// yet been seen, which are reported if it is never seen
+	provisional map[string]Problem
+	line        int
+	text        string
+}
+
+// lineParser parses a single line of a redirect map, split into fields.
+type lineParser func(im *importer, fields []string)
+
+// parsers returns a new lineParser for each supported format, since parsers may track
+// state across lines.
+var parsers = map[string]func() lineParser{
+	"netlify": func() lineParser { return parseNetlify },
+	"nginx":   newNginxParser,
+	"apache":  func() lineParser { return parseApache },
+}
+
+// Formats returns the names of the supported import formats.
+func Formats() []string {
+	return slices.Sorted(maps.Keys(parsers))
+}
+
+// Import parses a redirect map in the named format, returning the redirects it defines
+// sorted by alias, along with any problems translating it. Lines which define the same
+// alias as an earlier line are skipped, since the first matching rule is used by each
+// of the supported formats.
+func Import(r io.Reader, format string) ([]*server.Redirect, []Problem, error) {
+	newParser, ok := parsers[format]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown format '%s', must be one of: %s", format, strings.Join(Formats(), ", "))
+	}
+	parse := newParser()
+
+	im := &importer{redirects: map[string]*server.Redirect{}, provisional: map[string]Problem{}}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		im.line++
+		im.text = strings.TrimSpace(scanner.Text())
+		if im.text == "" || strings.HasPrefix(im.text, "#") {
+			continue
+		}
+		parse(im, strings.Fields(im.text))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	im.problems = append(im.problems, slices.Collect(maps.Values(im.provisional))...)
+	slices.SortStableFunc(im.problems, func(a, b Problem) int { return a.Line - b.Line })
+
+	var redirects []*server.Redirect
+	for _, alias := range slices.Sorted(maps.Keys(im.redirects)) {
+		redirects = append(redirects, im.redirects[alias])
+	}
+	return redirects, im.problems, nil
+}
+
+// problem records a problem with the current line.
+func (im *importer) problem(format string, args ...any) {
+	im.problems = append(im.problems, Problem{Line: im.line, Text: im.text, Reason: fmt.Sprintf(format, args...)})
+}
+
+// add adds a redirect from a request path to a destination, returning it if successful.
+func (im *importer) add(path string, url string, status int) *server.Redirect {
+	alias := strings.Trim(path, "/")
+	if alias == "" {
+		im.problem("redirects from the root path are not supported")
+		return nil
+	}
+	if _, exists := im.redirects[alias]; exists {
+		im.problem("duplicate alias '%s', skipped", alias)
+		return nil
+	}
+
+	r := &server.Redirect{Alias: alias, URL: url}
+	if err := r.Validate(); err != nil {
+		im.problem("%s", err.Error())
+		return nil
+	}
+	im.checkStatus(status)
+
+	im.redirects[alias] = r
+	return r
+}
+
+// checkStatus reports temporary redirects, which are imported but may be served as
+// permanent redirects, since gosherve decides for itself whether a redirect is permanent.
+func (im *importer) checkStatus(status int) {
+	if status != 301 && status != 308 {
+		im.problem("temporary redirect (%d) imported as a permanent redirect", status)
+	}
+}
+
+// literalPath matches a path which contains no placeholders, splats or query parameters.
+var literalPath = regexp.MustCompile(`^/[^*:?]*$`)
+
+// literalPattern matches an anchored regular expression which can only match a single
+// path, optionally with a trailing slash. The path is the first submatch.
+var literalPattern = regexp.MustCompile(`^\^(/(?:[^\\^$.|?*+()\[\]{}]|\\[.\-/])*?)(?:/\?)?\$$`)
+
+// patternPath returns the path matched by an anchored regular expression, if it can
+// only match a single path.
+func patternPath(pattern string) (string, bool) {
+	m := literalPattern.FindStringSubmatch(pattern)
+	if m == nil {
+		return "", false
+	}
+	return regexp.MustCompile(`\\(.)`).ReplaceAllString(m[1], "$1"), true
+}
+
+// netlifyStatus matches the status of a Netlify rule, which may be forced with "!"
+var netlifyStatus = regexp.MustCompile(`^([0-9]{3})!?$`)
+
+// netlifyPlaceholder matches a placeholder or splat in the destination of a Netlify rule
+var netlifyPlaceholder = regexp.MustCompile(`/:[A-Za-z]|\*`)
+
+// parseNetlify parses a rule of a Netlify _redirects file:
+//
+//	<from> <to> [status][!] [conditions]
+//
+// Language conditions are translated into language specific destinations.
+func parseNetlify(im *importer, fields []string) {
+	if len(fields) < 2 {
+		im.problem("expected a path and destination")
+		return
+	}
+	from, to, rest := fields[0], fields[1], fields[2:]
+
+	// Query parameters to match are listed between the path and destination
+	if !strings.HasPrefix(to, "/") && !strings.Contains(to, "://") {
+		im.problem("query parameter matching is not supported")
+		return
+	}
+
+	status := 301
+	if len(rest) > 0 {
+		if m := netlifyStatus.FindStringSubmatch(rest[0]); m != nil {
+			status, _ = strconv.Atoi(m[1])
+			rest = rest[1:]
+		}
+	}
+
+	if !literalPath.MatchString(from) || netlifyPlaceholder.MatchString(to) {
+		im.problem("placeholders and splats are not supported")
+		return
+	}
+	if status < 301 || status > 308 || status == 304 || status == 305 || status == 306 {
+		im.problem("status %d is not a redirect", status)
+		return
+	}
+
+	var languages []string
+	for _, cond := range rest {
+		key, value, ok := strings.Cut(cond, "=")
+		if !ok {
+			im.problem("invalid condition '%s'", cond)
+			return
+		}
+		if key != "Language" {
+			im.problem("%s conditions are not supported", key)
+			return
+		}
+		languages = append(languages, strings.Split(value, ",")...)
+	}
+
+	alias := strings.Trim(from, "/")
+	_, provisional := im.provisional[alias]
+
+	if len(languages) == 0 {
+		if !provisional {
+			im.add(from, to, status)
+			return
+		}
+		// Set the destination of a redirect created by preceding language specific rules
+		delete(im.provisional, alias)
+		r := im.redirects[alias]
+		r.URL = to
+		if err := r.Validate(); err != nil {
+			im.problem("%s", err.Error())
+			delete(im.redirects, alias)
+			return
+		}
+		im.checkStatus(status)
+		return
+	}
+
+	// Language specific rules are expected to precede the rule without conditions for
+	// the same path, since Netlify uses the first matching rule. Until that rule is
+	// seen, the first language specific destination is used.
+	r, exists := im.redirects[alias]
+	if !exists {
+		if r = im.add(from, to, 301); r == nil {
+			return
+		}
+		im.provisional[alias] = Problem{Line: im.line, Text: im.text,
+			Reason: "no rule without conditions, so the first language specific destination is the default"}
+	} else if !provisional {
+		im.problem("duplicate alias '%s', skipped", alias)
+		return
+	}
+
+	if r.Languages == nil {
+		r.Languages = map[string]string{}
+	}
+	for _, lang := range languages {
+		if _, exists := r.Languages[lang]; !exists {
+			r.Languages[lang] = to
+		}
+	}
+	if err := r.Validate(); err != nil {
+		im.problem("%s", err.Error())
+		delete(im.redirects, alias)
+		delete(im.provisional, alias)
+	}
+}
+
+// nginxStatuses maps the flags of an nginx rewrite directive to the status it redirects with
+var nginxStatuses = map[string]int{"permanent": 301, "redirect": 302}
+
+// exactLocation matches the opening of an nginx exact match location block
+var exactLocation = regexp.MustCompile(`^location\s+=\s*(\S+)\s*\{\s*(.*)$`)
+
+// newNginxParser returns a parser for nginx configuration, which translates return
+// directives in exact match location blocks and rewrite directives that redirect a
+// single path. Other directives are ignored.
+func newNginxParser() lineParser {
+	var location string
+	var depth int
+
+	var parse func(im *importer, text string)
+	parse = func(im *importer, text string) {
+		if m := exactLocation.FindStringSubmatch(text); m != nil {
+			location, depth = m[1], 1
+			if m[2] != "" {
+				parse(im, m[2])
+			}
+			return
+		}
+
+		for _, statement := range strings.Split(text, ";") {
+			fields := strings.Fields(strings.TrimSpace(strings.Trim(statement, "{}")))
+			if len(fields) > 0 {
+				parseNginxDirective(im, fields, location)
+			}
+			if location != "" {
+				depth += strings.Count(statement, "{") - strings.Count(statement, "}")
+				if depth <= 0 {
+					location = ""
+				}
+			}
+		}
+	}
+
+	return func(im *importer, fields []string) {
+		parse(im, strings.Join(fields, " "))
+	}
+}
+
+// parseNginxDirective translates a single nginx return or rewrite directive.
+func parseNginxDirective(im *importer, fields []string, location string) {
+	switch fields[0] {
+	case "return":
+		if len(fields) != 3 {
+			return
+		}
+		status, err := strconv.Atoi(fields[1])
+		if err != nil || status < 301 || status > 308 {
+			return
+		}
+		if location == "" {
+			im.problem("return outside of an exact match location block")
+			return
+		}
+		if strings.Contains(fields[2], "$") {
+			im.problem("variables are not supported")
+			return
+		}
+		im.add(location, strings.Trim(fields[2], `"'`), status)
+	case "rewrite":
+		if len(fields) < 3 {
+			im.problem("expected a pattern and replacement")
+			return
+		}
+		status, redirect := 0, false
+		if len(fields) > 3 {
+			status, redirect = nginxStatuses[fields[3]]
+		} else if strings.HasPrefix(fields[2], "http://") || strings.HasPrefix(fields[2], "https://") {
+			status, redirect = 302, true
+		}
+		if !redirect {
+			return
+		}
+		path, ok := patternPath(strings.Trim(fields[1], `"'`))
+		if !ok {
+			im.problem("pattern matches more than a single path")
+			return
+		}
+		if strings.Contains(fields[2], "$") {
+			im.problem("variables are not supported")
+			return
+		}
+		im.add(path, strings.Trim(fields[2], `"'`), status)
+	}
+}
+
+// apacheStatuses maps the keywords accepted as the status of Apache Redirect directives
+var apacheStatuses = map[string]int{"permanent": 301, "temp": 302, "seeother": 303, "gone": 410}
+
+// apacheStatus parses the status of an Apache Redirect directive.
+func apacheStatus(arg string) (int, bool) {
+	if status, ok := apacheStatuses[strings.ToLower(arg)]; ok {
+		return status, true
+	}
+	status, err := strconv.Atoi(arg)
+	return status, err == nil
+}
+
+// parseApache translates Apache Redirect, RedirectPermanent, RedirectTemp and
+// RedirectMatch directives. Redirect directives are reported, since they are imported
+// for their exact path only. RewriteRule directives are reported, and other directives
+// are ignored.
+func parseApache(im *importer, fields []string) {
+	directive := strings.ToLower(fields[0])
+	args := fields[1:]
+
+	status := 302
+	switch directive {
+	case "redirectpermanent":
+		status = 301
+	case "redirecttemp":
+	case "redirect", "redirectmatch":
+		// The status is optional, and precedes the path
+		if len(args) > 0 {
+			if s, ok := apacheStatus(args[0]); ok {
+				status, args = s, args[1:]
+			} else if len(args) == 3 {
+				im.problem("unknown status '%s'", args[0])
+				return
+			}
+		}
+	case "rewriterule":
+		im.problem("RewriteRule directives are not supported")
+		return
+	default:
+		return
+	}
+
+	if status < 301 || status > 308 {
+		im.problem("status %d is not a redirect", status)
+		return
+	}
+	if len(args) != 2 {
+		im.problem("expected a path and destination")
+		return
+	}
+
+	path := args[0]
+	if directive == "redirectmatch" {
+		p, ok := patternPath(path)
+		if !ok {
+			im.problem("pattern matches more than a single path")
+			return
+		}
+		path = p
+	}
+	if strings.Contains(args[1], "$") {
+		im.problem("backreferences are not supported")
+		return
+	}
+
+	// Redirect directives also match every path below their own, but only an exact
+	// match of the path is imported
+	if im.add(path, strings.Trim(args[1], `"`), status) != nil && directive != "redirectmatch" {
+		im.problem("prefix redirect imported for the exact path only, paths below it are not redirected")
+	}
+}
@@ -0,0 +1,157 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jnsgruk/gosherve/pkg/server"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type ImporterTestSuite struct{}
+
+var _ = check.Suite(&ImporterTestSuite{})
+
+// importString imports a redirect map, returning the redirects as lines of a gosherve
+// redirects file, and the problems as strings
+func importString(c *check.C, format string, input string) ([]string, []string) {
+	redirects, problems, err := Import(strings.NewReader(input), format)
+	c.Assert(err, check.IsNil)
+
+	lines := []string{}
+	for _, r := range redirects {
+		lines = append(lines, r.String())
+	}
+	reported := []string{}
+	for _, p := range problems {
+		reported = append(reported, p.String())
+	}
+	return lines, reported
+}
+
+// TestImportNetlify tests translation of Netlify _redirects rules
+func (s *ImporterTestSuite) TestImportNetlify(c *check.C) {
+	lines, problems := importString(c, "netlify", `
+# Comments and blank lines are ignored
+/home              https://example.com
+/docs/             https://docs.com/de     301!  Language=de,de-at
+/docs              https://docs.com/en
+/docs              https://docs.com/other
+/old               https://old.com         302
+/blog/:slug        https://blog.com/:slug
+/news/*            https://news.com/:splat
+/app               /index.html             200
+/store id=:id      /product/:id            301
+/uk                https://uk.example.com  302   Country=gb
+/fr                https://fr.example.com  301   Language=fr
+/about             /pages/about            301
+`)
+
+	c.Assert(lines, check.DeepEquals, []string{
+		"about /pages/about",
+		"docs https://docs.com/en lang=de,https://docs.com/de lang=de-at,https://docs.com/de",
+		"fr https://fr.example.com lang=fr,https://fr.example.com",
+		"home https://example.com",
+		"old https://old.com",
+	})
+	c.Assert(problems, check.DeepEquals, []string{
+		"line 6: duplicate alias 'docs', skipped: /docs              https://docs.com/other",
+		"line 7: temporary redirect (302) imported as a permanent redirect: /old               https://old.com         302",
+		"line 8: placeholders and splats are not supported: /blog/:slug        https://blog.com/:slug",
+		"line 9: placeholders and splats are not supported: /news/*            https://news.com/:splat",
+		"line 10: status 200 is not a redirect: /app               /index.html             200",
+		"line 11: query parameter matching is not supported: /store id=:id      /product/:id            301",
+		"line 12: Country conditions are not supported: /uk                https://uk.example.com  302   Country=gb",
+		"line 13: no rule without conditions, so the first language specific destination is the default: /fr                https://fr.example.com  301   Language=fr",
+	})
+}
+
+// TestImportNginx tests translation of nginx return and rewrite directives
+func (s *ImporterTestSuite) TestImportNginx(c *check.C) {
+	lines, problems := importString(c, "nginx", `
+server {
+    listen 80;
+    location = /foo {
+        return 301 https://foo.com;
+    }
+    location = /bar/ { return 308 "https://bar.com"; }
+    location /prefix {
+        return 301 https://prefix.com;
+    }
+    location = /var { return 301 https://var.com$request_uri; }
+    rewrite ^/baz/?$ https://baz.com permanent;
+    rewrite ^/a\.b$ https://ab.com redirect;
+    rewrite ^/temp$ https://temp.com;
+    rewrite ^/posts/(.*)$ https://posts.com/$1 permanent;
+    rewrite ^/internal$ /other last;
+    return 404;
+}
+`)
+
+	c.Assert(lines, check.DeepEquals, []string{
+		"a.b https://ab.com",
+		"bar https://bar.com",
+		"baz https://baz.com",
+		"foo https://foo.com",
+		"temp https://temp.com",
+	})
+	c.Assert(problems, check.DeepEquals, []string{
+		"line 9: return outside of an exact match location block: return 301 https://prefix.com;",
+		"line 11: variables are not supported: location = /var { return 301 https://var.com$request_uri; }",
+		"line 13: temporary redirect (302) imported as a permanent redirect: rewrite ^/a\\.b$ https://ab.com redirect;",
+		"line 14: temporary redirect (302) imported as a permanent redirect: rewrite ^/temp$ https://temp.com;",
+		"line 15: pattern matches more than a single path: rewrite ^/posts/(.*)$ https://posts.com/$1 permanent;",
+	})
+}
+
+// TestImportApache tests translation of Apache Redirect and RedirectMatch directives
+func (s *ImporterTestSuite) TestImportApache(c *check.C) {
+	lines, problems := importString(c, "apache", `
+Options +FollowSymLinks
+Redirect 301 /foo https://foo.com
+Redirect permanent /bar/ https://bar.com
+RedirectPermanent /baz https://baz.com
+RedirectMatch 301 ^/qux/?$ https://qux.com
+redirect /temp https://temp.com
+Redirect gone /old
+Redirect sometimes /odd https://odd.com
+RedirectMatch 301 ^/posts/(.*)$ https://posts.com/$1
+RewriteRule ^/x$ https://x.com [R=301,L]
+`)
+
+	c.Assert(lines, check.DeepEquals, []string{
+		"bar https://bar.com",
+		"baz https://baz.com",
+		"foo https://foo.com",
+		"qux https://qux.com",
+		"temp https://temp.com",
+	})
+	c.Assert(problems, check.DeepEquals, []string{
+		"line 3: prefix redirect imported for the exact path only, paths below it are not redirected: Redirect 301 /foo https://foo.com",
+		"line 4: prefix redirect imported for the exact path only, paths below it are not redirected: Redirect permanent /bar/ https://bar.com",
+		"line 5: prefix redirect imported for the exact path only, paths below it are not redirected: RedirectPermanent /baz https://baz.com",
+		"line 7: temporary redirect (302) imported as a permanent redirect: redirect /temp https://temp.com",
+		"line 7: prefix redirect imported for the exact path only, paths below it are not redirected: redirect /temp https://temp.com",
+		"line 8: status 410 is not a redirect: Redirect gone /old",
+		"line 9: unknown status 'sometimes': Redirect sometimes /odd https://odd.com",
+		"line 10: pattern matches more than a single path: RedirectMatch 301 ^/posts/(.*)$ https://posts.com/$1",
+		"line 11: RewriteRule directives are not supported: RewriteRule ^/x$ https://x.com [R=301,L]",
+	})
+}
+
+// TestImportUnknownFormat tests that unknown formats are rejected
+func (s *ImporterTestSuite) TestImportUnknownFormat(c *check.C) {
+	_, _, err := Import(strings.NewReader(""), "iis")
+	c.Assert(err, check.ErrorMatches, "unknown format 'iis', must be one of: apache, netlify, nginx")
+}
+
+// TestImportValid tests that imported redirects are valid gosherve redirects
+func (s *ImporterTestSuite) TestImportValid(c *check.C) {
+	redirects, problems, err := Import(strings.NewReader("/ok https://ok.com\n/ https://root.com\n"), "netlify")
+	c.Assert(err, check.IsNil)
+	c.Assert(redirects, check.DeepEquals, []*server.Redirect{{Alias: "ok", URL: "https://ok.com"}})
+	c.Assert(problems, check.HasLen, 1)
+	c.Assert(problems[0].Reason, check.Equals, "redirects from the root path are not supported")
+}
@@ -41,6 +41,12 @@ func GetLoggerFromCtx(ctx context.Context) *slog.Logger {
 	return l
 }
 
+// WithLogger returns a copy of the context which carries the specified logger, so
+// that it can be retrieved by GetLoggerFromCtx
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxLoggerKey, l)
+}
+
 // RequestLoggerMiddleware is a middleware that injects a logger into the request's
 // context which automatically includes a log group with request information
 func RequestLoggerMiddleware(next http.Handler) http.Handler {
@@ -51,7 +57,6 @@ func RequestLoggerMiddleware(next http.Handler) http.Handler {
 			"url", r.URL.Path,
 			"user_agent", r.UserAgent(),
 		))
-		ctx := context.WithValue(r.Context(), ctxLoggerKey, l)
-		next.ServeHTTP(rw, r.WithContext(ctx))
+		next.ServeHTTP(rw, r.WithContext(WithLogger(r.Context(), l)))
 	})
 }
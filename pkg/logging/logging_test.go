@@ -65,6 +65,14 @@ func (s *LoggingTestSuite) TestGetLoggerFromCtxFailure(c *check.C) {
 	c.Assert(loggerFromCtx, check.Equals, s.logger)
 }
 
+// TestWithLogger ensures that a logger added to a context with WithLogger
+// is returned by GetLoggerFromCtx.
+func (s *LoggingTestSuite) TestWithLogger(c *check.C) {
+	ctxLogger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	ctx := WithLogger(context.Background(), ctxLogger)
+	c.Assert(GetLoggerFromCtx(ctx), check.Equals, ctxLogger)
+}
+
 // TestRequestLoggerMiddleware ensures that a logger is attached
 // to the context of each request, and that logger includes a group
 // named "request" which contains "method" and "url" fields.
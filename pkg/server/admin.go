@@ -0,0 +1,336 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jnsgruk/gosherve/pkg/auth"
+	"github.com/jnsgruk/gosherve/pkg/logging"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// errRedirectExists is returned when creating a redirect for an alias that is already defined.
+var errRedirectExists = errors.New("redirect already exists")
+
+// redirectView is the representation of a redirect returned by the admin API. Password
+// hashes are never returned, so that they cannot be cracked offline by anyone able to
+// read redirects; only whether the redirect is protected is. For redirects with a
+// schedule, it includes the current destination and the next change.
+type redirectView struct {
+	*Redirect
+	Protected bool          `json:"password_protected,omitempty"`
+	Current   string        `json:"current_url,omitempty"`
+	Next      *ScheduledURL `json:"next,omitempty"`
+}
+
+// adminHandler returns the handler for the admin API, which allows redirects
+// to be listed, created, updated and deleted when the source is a RedirectStore,
+// and click analytics to be queried when enabled. If a TokenStore is configured,
+// each route requires a token with the relevant scope.
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/redirects", s.scoped(auth.ScopeLinksRead, s.handleListRedirects))
+	mux.Handle("GET /api/redirects/{alias...}", s.scoped(auth.ScopeLinksRead, s.handleGetRedirect))
+	if _, ok := s.source.(RedirectStore); ok {
+		mux.Handle("POST /api/redirects", s.scoped(auth.ScopeLinksWrite, s.handleCreateRedirect))
+		mux.Handle("POST /api/shorten", s.scoped(auth.ScopeLinksWrite, s.handleShorten))
+		mux.Handle("PUT /api/redirects/{alias...}", s.scoped(auth.ScopeLinksWrite, s.handleUpdateRedirect))
+		mux.Handle("DELETE /api/redirects/{alias...}", s.scoped(auth.ScopeLinksWrite, s.handleDeleteRedirect))
+	}
+	if s.analytics != nil {
+		mux.Handle("GET /api/analytics", s.scoped(auth.ScopeAnalytics, s.handleAnalyticsTotals))
+		mux.Handle("GET /api/analytics/{alias...}", s.scoped(auth.ScopeAnalytics, s.handleAnalyticsSeries))
+	}
+	mux.Handle("GET /api/hits", s.scoped(auth.ScopeLinksRead, s.handleHits))
+	mux.Handle("POST /api/reload", s.scoped(auth.ScopeReload, s.handleReload))
+	mux.Handle("GET /metrics", s.scoped(auth.ScopeMetrics, promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}).ServeHTTP))
+	// The web UI itself is static and unauthenticated; it uses the API with a token
+	// supplied by the user.
+	mux.Handle("GET /", s.uiHandler())
+	return mux
+}
+
+// adminEnabled reports whether the admin API has anything to serve, which is the case
+// if the source is a RedirectStore or analytics are enabled.
+func (s *Server) adminEnabled() bool {
+	_, ok := s.source.(RedirectStore)
+	return ok || s.analytics != nil
+}
+
+// ConfigureTokens sets the TokenStore used to authenticate requests to the admin API.
+func (s *Server) ConfigureTokens(tokens *auth.TokenStore) {
+	s.tokens = tokens
+}
+
+// scoped wraps a handler such that it requires a token with the specified scope,
+// if a TokenStore has been configured.
+func (s *Server) scoped(scope auth.Scope, h http.HandlerFunc) http.Handler {
+	if s.tokens == nil {
+		return h
+	}
+	return auth.RequireScope(s.tokens, scope, h)
+}
+
+// handleListRedirects returns all of the currently defined redirects, sorted by alias.
+func (s *Server) handleListRedirects(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	loaded := slices.Collect(maps.Values(s.redirects))
+	s.mu.RUnlock()
+
+	redirects := make([]redirectView, 0, len(loaded))
+	for _, rd := range loaded {
+		redirects = append(redirects, s.viewRedirect(rd))
+	}
+
+	slices.SortFunc(redirects, func(a, b redirectView) int { return strings.Compare(a.Alias, b.Alias) })
+	writeJSON(w, http.StatusOK, redirects)
+}
+
+// handleGetRedirect returns a single redirect by its alias.
+func (s *Server) handleGetRedirect(w http.ResponseWriter, r *http.Request) {
+	rd, exists := s.redirect(r.PathValue("alias"))
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, ErrRedirectNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.viewRedirect(rd))
+}
+
+// handleCreateRedirect creates a new redirect, failing if the alias is already defined.
+func (s *Server) handleCreateRedirect(w http.ResponseWriter, r *http.Request) {
+	rd, err := decodeRedirect(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, exists := s.redirect(rd.Alias); exists {
+		writeJSONError(w, http.StatusConflict, errRedirectExists)
+		return
+	}
+
+	if !s.putRedirect(w, r, rd) {
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.viewRedirect(rd))
+}
+
+// handleUpdateRedirect updates an existing redirect. Fields omitted from the body keep
+// their current values, so that clients need only send the fields they change. Clicks of
+// limited-use redirects are only reset if the body sets them.
+func (s *Server) handleUpdateRedirect(w http.ResponseWriter, r *http.Request) {
+	alias := r.PathValue("alias")
+
+	body, err := io.ReadAll(r.Body)
+	fields := map[string]json.RawMessage{}
+	if err == nil {
+		err = json.Unmarshal(body, &fields)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	current, exists := s.redirect(alias)
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, ErrRedirectNotFound)
+		return
+	}
+
+	// Maps are merged when decoded into, so those in the body replace the current ones
+	rd := *current
+	if _, ok := fields["devices"]; ok {
+		rd.Devices = nil
+	}
+	if _, ok := fields["languages"]; ok {
+		rd.Languages = nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rd); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+
+	if rd.Alias != alias {
+		writeJSONError(w, http.StatusBadRequest, errors.New("alias in body does not match path"))
+		return
+	}
+
+	if err := validateRedirect(&rd); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !s.putRedirect(w, r, &rd) {
+		return
+	}
+	if _, ok := fields["clicks"]; ok {
+		s.resetClicks(alias)
+	}
+	writeJSON(w, http.StatusOK, s.viewRedirect(&rd))
+}
+
+// handleDeleteRedirect removes a redirect by its alias.
+func (s *Server) handleDeleteRedirect(w http.ResponseWriter, r *http.Request) {
+	l := logging.GetLoggerFromCtx(r.Context())
+	alias := r.PathValue("alias")
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, exists := s.redirect(alias); !exists {
+		writeJSONError(w, http.StatusNotFound, ErrRedirectNotFound)
+		return
+	}
+
+	store := s.source.(RedirectStore)
+	if err := store.Delete(alias); err != nil && !errors.Is(err, ErrRedirectNotFound) {
+		l.Error("failed to delete redirect", "alias", alias, "error", err.Error())
+		writeJSONError(w, http.StatusInternalServerError, errors.New("failed to delete redirect"))
+		return
+	}
+
+	s.deleteRedirect(alias)
+	l.Info("deleted redirect", slog.Group("redirect", "alias", alias))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleShorten creates a redirect for a URL, generating an alias unless a vanity alias
+// is requested. If the URL has already been shortened, the existing redirect is returned.
+func (s *Server) handleShorten(w http.ResponseWriter, r *http.Request) {
+	req := &Redirect{}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	rd, created, err := s.shorten(req.URL, req.Alias)
+	if errors.Is(err, errRedirectExists) {
+		writeJSONError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !created {
+		writeJSON(w, http.StatusOK, s.viewRedirect(rd))
+		return
+	}
+
+	if err := validateRedirect(rd); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !s.putRedirect(w, r, rd) {
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.viewRedirect(rd))
+}
+
+// handleHits returns the number of times each redirect has been served since startup.
+func (s *Server) handleHits(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.hitCounts())
+}
+
+// handleReload refreshes the redirects from the configured source.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if err := s.RefreshRedirects(); err != nil {
+		writeJSONError(w, http.StatusBadGateway, err)
+		return
+	}
+	logging.GetLoggerFromCtx(r.Context()).Info("reloaded redirects", "count", s.NumRedirects())
+	writeJSON(w, http.StatusOK, map[string]int{"redirects": s.NumRedirects()})
+}
+
+// viewRedirect returns the admin API representation of a redirect, including clicks
+// which have not yet been persisted.
+func (s *Server) viewRedirect(rd *Redirect) redirectView {
+	view := *rd
+	view.PasswordHash = ""
+	view.Clicks = s.clicksUsed(rd)
+	v := redirectView{Redirect: &view, Protected: rd.PasswordHash != ""}
+	if len(rd.Schedule) > 0 {
+		now := s.now()
+		v.Current = rd.Destination(now)
+		v.Next = rd.NextChange(now)
+	}
+	return v
+}
+
+// putRedirect writes a redirect to the store and makes it immediately available
+// for lookups. If it fails, an error response is written and false is returned.
+func (s *Server) putRedirect(w http.ResponseWriter, r *http.Request, rd *Redirect) bool {
+	l := logging.GetLoggerFromCtx(r.Context())
+
+	store := s.source.(RedirectStore)
+	if err := store.Put(rd); err != nil {
+		l.Error("failed to store redirect", "alias", rd.Alias, "error", err.Error())
+		writeJSONError(w, http.StatusInternalServerError, errors.New("failed to store redirect"))
+		return false
+	}
+
+	s.setRedirect(rd)
+	l.Info("stored redirect", slog.Group("redirect", "alias", rd.Alias, "url", rd.URL))
+	return true
+}
+
+// decodeRedirect reads a redirect from a JSON request body and validates it.
+func decodeRedirect(r *http.Request) (*Redirect, error) {
+	rd := &Redirect{}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(rd); err != nil {
+		return nil, errors.New("invalid request body")
+	}
+	return rd, validateRedirect(rd)
+}
+
+// validateRedirect validates a redirect submitted to the admin API. Its destinations
+// must be http or https URLs or paths on this server, since they are rendered as links
+// in the web UI.
+func validateRedirect(rd *Redirect) error {
+	if err := rd.Validate(); err != nil {
+		return err
+	}
+	for _, u := range rd.destinations() {
+		if parsed, _ := url.Parse(u); parsed.Scheme != "" && !isWebURL(u) {
+			return fmt.Errorf("url must be an http or https url or a path: %s", u)
+		}
+	}
+	return nil
+}
+
+// writeJSON writes a JSON encoded response with the specified status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes a JSON encoded error response with the specified status code.
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
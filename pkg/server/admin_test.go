@@ -0,0 +1,283 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/auth"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/check.v1"
+)
+
+type AdminTestSuite struct {
+	server *Server
+	store  *MemoryStore
+}
+
+func (s *AdminTestSuite) SetUpTest(c *check.C) {
+	s.store = NewMemoryStore()
+	s.store.Put(&Redirect{Alias: "foo", URL: "http://foo.bar"})
+	s.server = NewServerWithSource(nil, s.store)
+	s.server.RefreshRedirects()
+}
+
+var _ = check.Suite(&AdminTestSuite{})
+
+// requestAdmin is a helper function that makes a mock request to the admin API
+// of a given server, returning the body and status code.
+func requestAdmin(s *Server, method, path, body string) (string, int) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	s.adminHandler().ServeHTTP(rr, req)
+	res := rr.Result()
+	b, _ := io.ReadAll(res.Body)
+	return string(b), res.StatusCode
+}
+
+// TestAdminListRedirects tests that all redirects are listed, sorted by alias
+func (s *AdminTestSuite) TestAdminListRedirects(c *check.C) {
+	s.server.setRedirect(&Redirect{Alias: "bar", URL: "http://bar.baz"})
+
+	body, code := requestAdmin(s.server, "GET", "/api/redirects", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+
+	var redirects []*Redirect
+	c.Assert(json.Unmarshal([]byte(body), &redirects), check.IsNil)
+	c.Assert(redirects, check.DeepEquals, []*Redirect{
+		{Alias: "bar", URL: "http://bar.baz"},
+		{Alias: "foo", URL: "http://foo.bar"},
+	})
+}
+
+// TestAdminGetRedirect tests fetching a single redirect, and a missing redirect
+func (s *AdminTestSuite) TestAdminGetRedirect(c *check.C) {
+	body, code := requestAdmin(s.server, "GET", "/api/redirects/foo", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(strings.TrimSpace(body), check.Equals, `{"alias":"foo","url":"http://foo.bar"}`)
+
+	body, code = requestAdmin(s.server, "GET", "/api/redirects/missing", "")
+	c.Assert(code, check.Equals, http.StatusNotFound)
+	c.Assert(strings.TrimSpace(body), check.Equals, `{"error":"redirect not found"}`)
+}
+
+// TestAdminCreateRedirect tests that a created redirect is stored and immediately
+// available to LookupRedirect
+func (s *AdminTestSuite) TestAdminCreateRedirect(c *check.C) {
+	_, code := requestAdmin(s.server, "POST", "/api/redirects", `{"alias":"bar","url":"http://bar.baz"}`)
+	c.Assert(code, check.Equals, http.StatusCreated)
+
+	url, err := s.server.LookupRedirect("bar")
+	c.Assert(err, check.IsNil)
+	c.Assert(url, check.Equals, "http://bar.baz")
+
+	stored, _ := s.store.Redirects()
+	c.Assert(stored["bar"], check.DeepEquals, &Redirect{Alias: "bar", URL: "http://bar.baz"})
+	c.Assert(readGauge(s.server.metrics.redirectsDefined), check.Equals, float64(2))
+}
+
+// TestAdminCreateRedirectInvalid tests that invalid and conflicting redirects are rejected
+func (s *AdminTestSuite) TestAdminCreateRedirectInvalid(c *check.C) {
+	var tests = []struct {
+		body  string
+		code  int
+		error string
+	}{
+		{`{"alias":"foo","url":"http://other"}`, http.StatusConflict, "redirect already exists"},
+		{`{"alias":"","url":"http://other"}`, http.StatusBadRequest, "alias must not be empty"},
+		{`{"alias":"a b","url":"http://other"}`, http.StatusBadRequest, "alias must not contain spaces"},
+		{`{"alias":"new","url":"http://a b"}`, http.StatusBadRequest, "url must not contain spaces"},
+		{`{"alias":"new","url":"javascript:alert(1)"}`, http.StatusBadRequest, "url must be an http or https url or a path: javascript:alert(1)"},
+		{`{"alias":"new","url":"http://other","devices":{"ios":"data:text/html,hi"}}`, http.StatusBadRequest, "url must be an http or https url or a path: data:text/html,hi"},
+		{`{"alias":"new","url":"http://other","extra":1}`, http.StatusBadRequest, "invalid request body"},
+		{`not json`, http.StatusBadRequest, "invalid request body"},
+	}
+
+	for _, t := range tests {
+		body, code := requestAdmin(s.server, "POST", "/api/redirects", t.body)
+		c.Assert(code, check.Equals, t.code)
+		c.Assert(strings.TrimSpace(body), check.Equals, `{"error":"`+t.error+`"}`)
+	}
+	c.Assert(s.server.NumRedirects(), check.Equals, 1)
+}
+
+// TestAdminCreateRedirectPath tests that redirects to paths on this server are accepted
+func (s *AdminTestSuite) TestAdminCreateRedirectPath(c *check.C) {
+	_, code := requestAdmin(s.server, "POST", "/api/redirects", `{"alias":"blog","url":"/blog/"}`)
+	c.Assert(code, check.Equals, http.StatusCreated)
+
+	_, code = requestRoute(s.server, "/blog")
+	c.Assert(code, check.Equals, http.StatusMovedPermanently)
+}
+
+// TestAdminUpdateRedirect tests updating an existing redirect, and failing to
+// update a missing one
+func (s *AdminTestSuite) TestAdminUpdateRedirect(c *check.C) {
+	_, code := requestAdmin(s.server, "PUT", "/api/redirects/foo", `{"url":"http://new.foo"}`)
+	c.Assert(code, check.Equals, http.StatusOK)
+
+	url, err := s.server.LookupRedirect("foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(url, check.Equals, "http://new.foo")
+
+	_, code = requestAdmin(s.server, "PUT", "/api/redirects/foo", `{"alias":"bar","url":"http://new.foo"}`)
+	c.Assert(code, check.Equals, http.StatusBadRequest)
+
+	_, code = requestAdmin(s.server, "PUT", "/api/redirects/missing", `{"url":"http://new.foo"}`)
+	c.Assert(code, check.Equals, http.StatusNotFound)
+}
+
+// TestAdminUpdateRedirectMerge tests that fields omitted from an update keep their
+// current values, including clicks used since the redirect was listed
+func (s *AdminTestSuite) TestAdminUpdateRedirectMerge(c *check.C) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	s.server.setRedirect(&Redirect{
+		Alias: "invite", URL: "http://invite.bar", MaxClicks: 3, PasswordHash: string(hash),
+		Devices: map[string]string{"ios": "http://ios.bar", "android": "http://android.bar"},
+	})
+	c.Assert(s.server.consumeClick("invite"), check.IsNil)
+	c.Assert(s.server.consumeClick("invite"), check.IsNil)
+
+	_, code := requestAdmin(s.server, "PUT", "/api/redirects/invite", `{"url":"http://new.bar","devices":{"ios":"http://ios.bar"}}`)
+	c.Assert(code, check.Equals, http.StatusOK)
+
+	rd, _ := s.server.redirect("invite")
+	c.Assert(rd.URL, check.Equals, "http://new.bar")
+	c.Assert(rd.PasswordHash, check.Equals, string(hash))
+	c.Assert(rd.MaxClicks, check.Equals, 3)
+	c.Assert(rd.Devices, check.DeepEquals, map[string]string{"ios": "http://ios.bar"})
+	c.Assert(s.server.clicksUsed(rd), check.Equals, 2)
+
+	c.Assert(s.server.flushClicks(), check.IsNil)
+	redirects, _ := s.store.Redirects()
+	c.Assert(redirects["invite"].URL, check.Equals, "http://new.bar")
+	c.Assert(redirects["invite"].Clicks, check.Equals, 2)
+}
+
+// TestAdminRedirectPasswordHidden tests that password hashes are not returned by the
+// API, which instead reports whether a redirect is password protected
+func (s *AdminTestSuite) TestAdminRedirectPasswordHidden(c *check.C) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	created := `{"alias":"secret","url":"http://secret.bar","password_hash":"` + string(hash) + `"}`
+	expected := `{"alias":"secret","url":"http://secret.bar","password_protected":true}`
+
+	body, code := requestAdmin(s.server, "POST", "/api/redirects", created)
+	c.Assert(code, check.Equals, http.StatusCreated)
+	c.Assert(strings.TrimSpace(body), check.Equals, expected)
+
+	body, code = requestAdmin(s.server, "GET", "/api/redirects/secret", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(strings.TrimSpace(body), check.Equals, expected)
+
+	body, code = requestAdmin(s.server, "GET", "/api/redirects", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Not(check.Matches), `(?s).*password_hash.*`)
+	c.Assert(body, check.Matches, `(?s).*"password_protected":true.*`)
+
+	rd, _ := s.server.redirect("secret")
+	c.Assert(rd.PasswordHash, check.Equals, string(hash))
+}
+
+// TestAdminDeleteRedirect tests that a deleted redirect is removed from the store
+// and can no longer be looked up
+func (s *AdminTestSuite) TestAdminDeleteRedirect(c *check.C) {
+	_, code := requestAdmin(s.server, "DELETE", "/api/redirects/foo", "")
+	c.Assert(code, check.Equals, http.StatusNoContent)
+
+	_, err := s.server.LookupRedirect("foo")
+	c.Assert(err, check.Equals, ErrRedirectNotFound)
+
+	_, code = requestAdmin(s.server, "DELETE", "/api/redirects/foo", "")
+	c.Assert(code, check.Equals, http.StatusNotFound)
+}
+
+// TestAdminRequiresScopes tests that when tokens are configured, admin routes
+// require a token with the relevant scope
+func (s *AdminTestSuite) TestAdminRequiresScopes(c *check.C) {
+	tokens, _ := auth.NewTokenStore(path.Join(c.MkDir(), "tokens.json"))
+	s.server.ConfigureTokens(tokens)
+	reader, _, _ := tokens.Mint("reader", []auth.Scope{auth.ScopeLinksRead})
+	reloader, _, _ := tokens.Mint("reloader", []auth.Scope{auth.ScopeReload})
+
+	var tests = []struct {
+		method string
+		path   string
+		token  string
+		code   int
+	}{
+		{"GET", "/api/redirects", "", http.StatusUnauthorized},
+		{"GET", "/api/redirects", reader, http.StatusOK},
+		{"GET", "/api/redirects/foo", reader, http.StatusOK},
+		{"DELETE", "/api/redirects/foo", reader, http.StatusForbidden},
+		{"POST", "/api/reload", reader, http.StatusForbidden},
+		{"POST", "/api/reload", reloader, http.StatusOK},
+		{"GET", "/metrics", reloader, http.StatusForbidden},
+	}
+
+	for _, t := range tests {
+		req := httptest.NewRequest(t.method, t.path, nil)
+		if t.token != "" {
+			req.Header.Set("Authorization", "Bearer "+t.token)
+		}
+		rr := httptest.NewRecorder()
+		s.server.adminHandler().ServeHTTP(rr, req)
+		c.Assert(rr.Code, check.Equals, t.code, check.Commentf("%s %s", t.method, t.path))
+	}
+}
+
+// TestAdminHits tests that the number of times each redirect is served is reported
+func (s *AdminTestSuite) TestAdminHits(c *check.C) {
+	requestRoute(s.server, "/foo")
+	requestRoute(s.server, "/foo")
+
+	body, code := requestAdmin(s.server, "GET", "/api/hits", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(strings.TrimSpace(body), check.Equals, `{"foo":2}`)
+}
+
+// TestAdminUI tests that the embedded web UI is served without authentication
+func (s *AdminTestSuite) TestAdminUI(c *check.C) {
+	tokens, _ := auth.NewTokenStore(path.Join(c.MkDir(), "tokens.json"))
+	s.server.ConfigureTokens(tokens)
+
+	body, code := requestAdmin(s.server, "GET", "/", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Matches, "(?s).*<title>gosherve admin</title>.*")
+
+	_, code = requestAdmin(s.server, "GET", "/app.js", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+}
+
+// TestAdminScheduledRedirect tests that the current destination and next change of
+// a scheduled redirect are included in the listing
+func (s *AdminTestSuite) TestAdminScheduledRedirect(c *check.C) {
+	s.server.now = func() time.Time { return time.Date(2026, 2, 15, 0, 0, 0, 0, time.UTC) }
+
+	_, code := requestAdmin(s.server, "POST", "/api/redirects", `{"alias":"talk","url":"http://a.com","schedule":[
+		{"at":"2026-02-01T00:00:00Z","url":"http://b.com"},
+		{"at":"2026-03-01T00:00:00Z","url":"http://c.com"}
+	]}`)
+	c.Assert(code, check.Equals, http.StatusCreated)
+
+	body, code := requestAdmin(s.server, "GET", "/api/redirects/talk", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+
+	var view struct {
+		Current string        `json:"current_url"`
+		Next    *ScheduledURL `json:"next"`
+	}
+	c.Assert(json.Unmarshal([]byte(body), &view), check.IsNil)
+	c.Assert(view.Current, check.Equals, "http://b.com")
+	c.Assert(view.Next.URL, check.Equals, "http://c.com")
+
+	body, code = requestAdmin(s.server, "POST", "/api/redirects", `{"alias":"bad","url":"http://a.com","schedule":[
+		{"at":"2026-03-01T00:00:00Z","url":"http://c.com"},
+		{"at":"2026-02-01T00:00:00Z","url":"http://b.com"}
+	]}`)
+	c.Assert(code, check.Equals, http.StatusBadRequest)
+	c.Assert(strings.TrimSpace(body), check.Equals, `{"error":"schedule must be ordered by time"}`)
+}
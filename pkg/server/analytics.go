@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/analytics"
+)
+
+const (
+	// analyticsFlushInterval is how often click analytics are written to disk. Clicks
+	// recorded since the last flush are lost if the process exits.
+	analyticsFlushInterval = time.Minute
+	// analyticsDefaultRange is the time range reported by the analytics API if none
+	// is specified.
+	analyticsDefaultRange = 7 * 24 * time.Hour
+)
+
+// ConfigureAnalytics enables recording clicks on redirects in the specified store,
+// which can then be queried using the admin API.
+func (s *Server) ConfigureAnalytics(store *analytics.Store) {
+	s.analytics = store
+}
+
+// recordClick records a click on a redirect in the analytics store, if configured.
+// Only the host of the referring page and the device class of the client are kept.
+func (s *Server) recordClick(r *http.Request, alias string) {
+	if s.analytics == nil {
+		return
+	}
+	s.analytics.Record(analytics.Click{
+		Alias:    alias,
+		Time:     s.now(),
+		Referrer: referrerHost(r),
+		Device:   classifyUserAgent(r.UserAgent()),
+	})
+}
+
+// referrerHost returns the host of the page which referred a request, or an empty
+// string if there is none.
+func referrerHost(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// flushAnalytics writes the analytics store to disk at a regular interval.
+func (s *Server) flushAnalytics() {
+	for range time.Tick(analyticsFlushInterval) {
+		if err := s.analytics.Flush(s.now()); err != nil {
+			slog.Error("failed to write analytics", "error", err.Error())
+		}
+	}
+}
+
+// handleAnalyticsTotals returns the number of clicks on each alias in a time range.
+func (s *Server) handleAnalyticsTotals(w http.ResponseWriter, r *http.Request) {
+	from, to, err := s.analyticsRange(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"from":   from,
+		"to":     to,
+		"clicks": s.analytics.Totals(from, to),
+	})
+}
+
+// handleAnalyticsSeries returns the clicks on an alias over time, along with their
+// referrers and device classes.
+func (s *Server) handleAnalyticsSeries(w http.ResponseWriter, r *http.Request) {
+	from, to, err := s.analyticsRange(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "hour"
+	}
+
+	series, err := s.analytics.Series(analytics.Query{
+		Alias:    r.PathValue("alias"),
+		From:     from,
+		To:       to,
+		Interval: interval,
+	})
+	if errors.Is(err, analytics.ErrInvalidQuery) {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, series)
+}
+
+// analyticsRange returns the time range specified by the RFC 3339 "from" and "to"
+// query parameters, which default to the last week.
+func (s *Server) analyticsRange(r *http.Request) (time.Time, time.Time, error) {
+	to := s.now()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid to time, must be RFC 3339")
+		}
+		to = t
+	}
+
+	from := to.Add(-analyticsDefaultRange)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid from time, must be RFC 3339")
+		}
+		from = t
+	}
+	return from, to, nil
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/analytics"
+	"gopkg.in/check.v1"
+)
+
+type AnalyticsTestSuite struct {
+	server *Server
+	store  *analytics.Store
+	now    time.Time
+}
+
+func (s *AnalyticsTestSuite) SetUpTest(c *check.C) {
+	store, err := analytics.NewStore(path.Join(c.MkDir(), "analytics.json"), 0)
+	c.Assert(err, check.IsNil)
+	s.store = store
+
+	s.now = time.Date(2026, 3, 2, 12, 30, 0, 0, time.UTC)
+	s.server = NewServerWithSource(nil, readOnlySource("foo http://foo.bar\nbar http://bar.baz\n"))
+	s.server.now = func() time.Time { return s.now }
+	s.server.ConfigureAnalytics(store)
+	s.server.RefreshRedirects()
+}
+
+var _ = check.Suite(&AnalyticsTestSuite{})
+
+// click requests a redirect with the specified referrer and User-Agent
+func (s *AnalyticsTestSuite) click(alias string, referrer string, ua string) {
+	req := httptest.NewRequest("GET", "/"+alias, nil)
+	req.Header.Set("Referer", referrer)
+	req.Header.Set("User-Agent", ua)
+	s.server.routeHandler(httptest.NewRecorder(), req)
+}
+
+// TestAnalyticsRecordsClicks tests that clicks are recorded with their referring host
+// and device class, and can be queried with the admin API
+func (s *AnalyticsTestSuite) TestAnalyticsRecordsClicks(c *check.C) {
+	s.click("foo", "https://News.YCombinator.com/item?id=1", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)")
+	s.click("foo", "", "Mozilla/5.0 (X11; Linux x86_64)")
+	s.click("foo", "not a url", "Mozilla/5.0 (X11; Linux x86_64)")
+	s.click("bar", "", "Googlebot/2.1")
+	s.click("missing", "", "")
+
+	body, code := requestAdmin(s.server, "GET", "/api/analytics/foo?from=2026-03-02T10:00:00Z", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+
+	var series analytics.Series
+	c.Assert(json.Unmarshal([]byte(body), &series), check.IsNil)
+	c.Assert(series.Total, check.Equals, uint64(3))
+	c.Assert(series.Interval, check.Equals, "hour")
+	c.Assert(series.Points, check.HasLen, 3)
+	c.Assert(series.Points[2].Clicks, check.Equals, uint64(3))
+	c.Assert(series.Referrers, check.DeepEquals, map[string]uint64{"news.ycombinator.com": 1, "": 2})
+	c.Assert(series.Devices, check.DeepEquals, map[string]uint64{DeviceIOS: 1, DeviceDesktop: 2})
+
+	body, code = requestAdmin(s.server, "GET", "/api/analytics", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+	var totals struct {
+		Clicks map[string]uint64 `json:"clicks"`
+	}
+	c.Assert(json.Unmarshal([]byte(body), &totals), check.IsNil)
+	c.Assert(totals.Clicks, check.DeepEquals, map[string]uint64{"foo": 3, "bar": 1})
+}
+
+// TestAnalyticsInvalidQueries tests that invalid query parameters are rejected
+func (s *AnalyticsTestSuite) TestAnalyticsInvalidQueries(c *check.C) {
+	for _, q := range []string{"from=yesterday", "to=2026-03-02", "interval=week", "from=2026-03-03T00:00:00Z"} {
+		_, code := requestAdmin(s.server, "GET", "/api/analytics/foo?"+q, "")
+		c.Assert(code, check.Equals, http.StatusBadRequest, check.Commentf(q))
+	}
+}
+
+// TestAnalyticsReadOnlySource tests that the admin API is served for read-only sources
+// when analytics are enabled, but without the routes which modify redirects
+func (s *AnalyticsTestSuite) TestAnalyticsReadOnlySource(c *check.C) {
+	c.Assert(s.server.adminEnabled(), check.Equals, true)
+
+	_, code := requestAdmin(s.server, "GET", "/api/redirects/foo", "")
+	c.Assert(code, check.Equals, http.StatusOK)
+	_, code = requestAdmin(s.server, "DELETE", "/api/redirects/foo", "")
+	c.Assert(code, check.Equals, http.StatusMethodNotAllowed)
+
+	s.server.ConfigureAnalytics(nil)
+	c.Assert(s.server.adminEnabled(), check.Equals, false)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// clicksFlushInterval is how often clicks of limited-use redirects in a RedirectStore
+// are persisted. Clicks counted since the last flush are lost if the process exits.
+const clicksFlushInterval = 10 * time.Second
+
+// clicksUsed returns the number of times a limited-use redirect has been followed.
+func (s *Server) clicksUsed(r *Redirect) int {
+	s.clicksMu.Lock()
+	defer s.clicksMu.Unlock()
+	return s.countedClicks(r)
+}
+
+// countedClicks returns the number of times a limited-use redirect has been followed,
+// and must be called with clicksMu held. For a RedirectStore, the clicks counted in
+// memory are those which have not yet been flushed to the store, so they are added to
+// the stored count. Otherwise they are all clicks since startup, which are never
+// persisted because the source is read-only.
+func (s *Server) countedClicks(r *Redirect) int {
+	if _, ok := s.source.(RedirectStore); ok {
+		return r.Clicks + s.clicks[r.Alias]
+	}
+	return max(s.clicks[r.Alias], r.Clicks)
+}
+
+// exhausted reports whether a limited-use redirect has no clicks remaining.
+func (s *Server) exhausted(r *Redirect) bool {
+	return r.MaxClicks > 0 && s.clicksUsed(r) >= r.MaxClicks
+}
+
+// consumesClick reports whether a request for a limited-use redirect uses one of its
+// clicks. Only GET requests from clients other than bots are counted, so that link
+// unfurlers and HEAD requests cannot use a link up before its recipient follows it.
+// Submitting the password of a protected redirect is also counted, since the client
+// is redirected in response.
+func consumesClick(r *http.Request, rd *Redirect) bool {
+	if classifyUserAgent(r.UserAgent()) == DeviceBot {
+		return false
+	}
+	return r.Method == http.MethodGet || r.Method == http.MethodPost && rd.PasswordHash != ""
+}
+
+// consumeClick records a click of a limited-use redirect, returning ErrRedirectExpired
+// if it has no clicks remaining. Clicks are counted in memory under a lock so that
+// concurrent requests cannot exceed the limit. If the source is a RedirectStore, they
+// are persisted in batches by flushClicks, so that they are not reset when gosherve is
+// restarted.
+func (s *Server) consumeClick(alias string) error {
+	s.clicksMu.Lock()
+	defer s.clicksMu.Unlock()
+
+	r, exists := s.redirect(alias)
+	if !exists {
+		return ErrRedirectNotFound
+	}
+
+	used := s.countedClicks(r)
+	if used >= r.MaxClicks {
+		return ErrRedirectExpired
+	}
+	if _, ok := s.source.(RedirectStore); ok {
+		s.clicks[alias]++
+	} else {
+		s.clicks[alias] = used + 1
+	}
+	return nil
+}
+
+// resetClicks discards the clicks of a redirect which are counted in memory, so that
+// only those of the loaded redirect are used.
+func (s *Server) resetClicks(alias string) {
+	s.clicksMu.Lock()
+	delete(s.clicks, alias)
+	s.clicksMu.Unlock()
+}
+
+// flushClicks writes the clicks counted since the last flush to the RedirectStore, if
+// the source is one, updating all of the clicked redirects in a single write. Writes
+// through the admin API are excluded during the flush so that they are not overwritten,
+// and clicks are excluded so that none are counted twice or lost.
+func (s *Server) flushClicks() error {
+	store, ok := s.source.(RedirectStore)
+	if !ok {
+		return nil
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.clicksMu.Lock()
+	defer s.clicksMu.Unlock()
+
+	updated := make([]*Redirect, 0, len(s.clicks))
+	for alias, clicks := range s.clicks {
+		current, exists := s.redirect(alias)
+		if !exists {
+			continue
+		}
+		r := *current
+		r.Clicks += clicks
+		updated = append(updated, &r)
+	}
+	if len(updated) == 0 {
+		return nil
+	}
+
+	if err := store.Put(updated...); err != nil {
+		return fmt.Errorf("error persisting clicks: %w", err)
+	}
+
+	s.mu.Lock()
+	for _, r := range updated {
+		s.redirects[r.Alias] = r
+	}
+	s.mu.Unlock()
+	clear(s.clicks)
+	return nil
+}
+
+// persistClicks flushes clicks to the RedirectStore at a regular interval.
+func (s *Server) persistClicks() {
+	for range time.Tick(clicksFlushInterval) {
+		if err := s.flushClicks(); err != nil {
+			slog.Error("failed to persist clicks", "error", err.Error())
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+
+	"gopkg.in/check.v1"
+)
+
+type ClicksTestSuite struct {
+	server *Server
+	store  *MemoryStore
+}
+
+// readOnlySource is a RedirectSource which parses a fixed redirects file on each fetch
+type readOnlySource string
+
+func (r readOnlySource) Redirects() (map[string]*Redirect, error) {
+	return parseRedirects(string(r)), nil
+}
+
+func (s *ClicksTestSuite) SetUpTest(c *check.C) {
+	s.store = NewMemoryStore()
+	s.store.Put(&Redirect{Alias: "invite", URL: "http://invite.bar", MaxClicks: 2})
+	s.server = NewServerWithSource(nil, s.store)
+	s.server.RefreshRedirects()
+}
+
+var _ = check.Suite(&ClicksTestSuite{})
+
+// TestClicksExhausted tests that a limited-use redirect returns 410 once its clicks are used
+func (s *ClicksTestSuite) TestClicksExhausted(c *check.C) {
+	for i := 0; i < 2; i++ {
+		_, code := requestRoute(s.server, "/invite")
+		c.Assert(code, check.Equals, http.StatusFound)
+	}
+
+	_, code := requestRoute(s.server, "/invite")
+	c.Assert(code, check.Equals, http.StatusGone)
+
+	// Previews and QR codes of exhausted redirects are also gone
+	_, code = requestRoute(s.server, "/invite+")
+	c.Assert(code, check.Equals, http.StatusGone)
+
+	// Clicks are only written to the store when they are flushed
+	redirects, _ := s.store.Redirects()
+	c.Assert(redirects["invite"].Clicks, check.Equals, 0)
+	c.Assert(s.server.flushClicks(), check.IsNil)
+	redirects, _ = s.store.Redirects()
+	c.Assert(redirects["invite"].Clicks, check.Equals, 2)
+
+	_, code = requestRoute(s.server, "/invite")
+	c.Assert(code, check.Equals, http.StatusGone)
+}
+
+// TestClicksNotConsumed tests that HEAD requests and bots, such as link unfurlers, are
+// shown the preview of a limited-use redirect without using any of its clicks
+func (s *ClicksTestSuite) TestClicksNotConsumed(c *check.C) {
+	head := httptest.NewRequest("HEAD", "/invite", nil)
+	bot := httptest.NewRequest("GET", "/invite", nil)
+	bot.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+
+	for _, req := range []*http.Request{head, bot, head, bot} {
+		rr := httptest.NewRecorder()
+		s.server.routeHandler(rr, req)
+		c.Assert(rr.Code, check.Equals, http.StatusOK)
+		c.Assert(rr.Header().Get("Location"), check.Equals, "")
+	}
+
+	for i := 0; i < 2; i++ {
+		_, code := requestRoute(s.server, "/invite")
+		c.Assert(code, check.Equals, http.StatusFound)
+	}
+}
+
+// TestClicksConcurrent tests that concurrent requests cannot exceed the click limit
+func (s *ClicksTestSuite) TestClicksConcurrent(c *check.C) {
+	s.server.setRedirect(&Redirect{Alias: "invite", URL: "http://invite.bar", MaxClicks: 10})
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, code := requestRoute(s.server, "/invite")
+			codes <- code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	served := 0
+	for code := range codes {
+		if code == http.StatusFound {
+			served++
+		}
+	}
+	c.Assert(served, check.Equals, 10)
+
+	c.Assert(s.server.flushClicks(), check.IsNil)
+	redirects, _ := s.store.Redirects()
+	c.Assert(redirects["invite"].Clicks, check.Equals, 10)
+}
+
+// TestClicksPersisted tests that clicks flushed to a FileStore survive a restart
+func (s *ClicksTestSuite) TestClicksPersisted(c *check.C) {
+	storePath := path.Join(c.MkDir(), "redirects.json")
+	store, err := NewFileStore(storePath)
+	c.Assert(err, check.IsNil)
+	store.Put(&Redirect{Alias: "once", URL: "http://once.bar", MaxClicks: 1})
+
+	server := NewServerWithSource(nil, store)
+	server.RefreshRedirects()
+	_, code := requestRoute(server, "/once")
+	c.Assert(code, check.Equals, http.StatusFound)
+	c.Assert(server.flushClicks(), check.IsNil)
+
+	store, err = NewFileStore(storePath)
+	c.Assert(err, check.IsNil)
+	server = NewServerWithSource(nil, store)
+	server.RefreshRedirects()
+	_, code = requestRoute(server, "/once")
+	c.Assert(code, check.Equals, http.StatusGone)
+}
+
+// TestClicksFlushBatched tests that the clicks of several redirects are flushed to the
+// store in a single write, and that clicks counted since are still included
+func (s *ClicksTestSuite) TestClicksFlushBatched(c *check.C) {
+	s.store.Put(&Redirect{Alias: "other", URL: "http://other.bar", MaxClicks: 2})
+	store := &countingStore{MemoryStore: s.store}
+	s.server = NewServerWithSource(nil, store)
+	s.server.RefreshRedirects()
+
+	requestRoute(s.server, "/invite")
+	requestRoute(s.server, "/other")
+	c.Assert(store.puts, check.Equals, 0)
+	c.Assert(s.server.flushClicks(), check.IsNil)
+	c.Assert(store.puts, check.Equals, 1)
+
+	redirects, _ := store.Redirects()
+	c.Assert(redirects["invite"].Clicks, check.Equals, 1)
+	c.Assert(redirects["other"].Clicks, check.Equals, 1)
+
+	// Nothing is written if there have been no clicks since the last flush
+	c.Assert(s.server.flushClicks(), check.IsNil)
+	c.Assert(store.puts, check.Equals, 1)
+
+	_, code := requestRoute(s.server, "/invite")
+	c.Assert(code, check.Equals, http.StatusFound)
+	_, code = requestRoute(s.server, "/invite")
+	c.Assert(code, check.Equals, http.StatusGone)
+}
+
+// countingStore is a MemoryStore which counts the number of times it is written
+type countingStore struct {
+	*MemoryStore
+	puts int
+}
+
+func (c *countingStore) Put(redirects ...*Redirect) error {
+	c.puts++
+	return c.MemoryStore.Put(redirects...)
+}
+
+// TestClicksReadOnlySource tests that clicks of redirects from a read-only source are
+// not reset when the redirects are refreshed
+func (s *ClicksTestSuite) TestClicksReadOnlySource(c *check.C) {
+	server := NewServerWithSource(nil, readOnlySource("once http://once.bar max_clicks=1\n"))
+	server.RefreshRedirects()
+
+	_, code := requestRoute(server, "/once")
+	c.Assert(code, check.Equals, http.StatusFound)
+
+	server.RefreshRedirects()
+	_, code = requestRoute(server, "/once")
+	c.Assert(code, check.Equals, http.StatusGone)
+}
+
+// TestClicksValidation tests parsing and validation of max_clicks and clicks
+func (s *ClicksTestSuite) TestClicksValidation(c *check.C) {
+	redirects := parseRedirects("a http://a.com max_clicks=3 clicks=2\nb http://b.com max_clicks=-1\nc http://c.com max_clicks=x\nd http://d.com clicks=x\n")
+
+	c.Assert(redirects, check.HasLen, 1)
+	c.Assert(redirects["a"].MaxClicks, check.Equals, 3)
+	c.Assert(redirects["a"].Clicks, check.Equals, 2)
+	c.Assert(redirects["a"].String(), check.Equals, "a http://a.com max_clicks=3 clicks=2")
+}
+
+// TestClicksReset tests that a redirect can be followed again once its clicks are reset
+// through the admin API, or it is deleted and created again
+func (s *ClicksTestSuite) TestClicksReset(c *check.C) {
+	s.exhaust(c)
+	_, code := requestAdmin(s.server, "PUT", "/api/redirects/invite", `{"alias":"invite","url":"http://invite.bar","max_clicks":2,"clicks":0}`)
+	c.Assert(code, check.Equals, http.StatusOK)
+	_, code = requestRoute(s.server, "/invite")
+	c.Assert(code, check.Equals, http.StatusFound)
+
+	s.exhaust(c)
+	_, code = requestAdmin(s.server, "DELETE", "/api/redirects/invite", "")
+	c.Assert(code, check.Equals, http.StatusNoContent)
+	_, code = requestAdmin(s.server, "POST", "/api/redirects", `{"alias":"invite","url":"http://invite.bar","max_clicks":2}`)
+	c.Assert(code, check.Equals, http.StatusCreated)
+	_, code = requestRoute(s.server, "/invite")
+	c.Assert(code, check.Equals, http.StatusFound)
+}
+
+// exhaust follows the invite redirect until it is gone
+func (s *ClicksTestSuite) exhaust(c *check.C) {
+	for i := 0; i < 3; i++ {
+		requestRoute(s.server, "/invite")
+	}
+	_, code := requestRoute(s.server, "/invite")
+	c.Assert(code, check.Equals, http.StatusGone)
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// VersionedSource is a RedirectSource which can report the version of the redirects
+// it last returned, such as a commit hash.
+type VersionedSource interface {
+	RedirectSource
+	Version() string
+}
+
+// GitSource is a read-only RedirectSource that reads a redirects file from a git
+// repository. The repository is cloned into memory, and fetched each time the
+// redirects are requested, so that new commits are picked up.
+type GitSource struct {
+	mu        sync.Mutex
+	repo      *git.Repository
+	ref       string
+	path      string
+	commit    plumbing.Hash
+	parsed    plumbing.Hash
+	redirects map[string]*Redirect
+}
+
+// NewGitSource returns a RedirectSource that reads redirects from the file at path in
+// the repository at url, which may be a local path or a clone URL. The ref may name
+// a branch, tag or commit; if empty, the default branch of the repository is used.
+func NewGitSource(url string, ref string, path string) (*GitSource, error) {
+	repo, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: url, Tags: git.AllTags})
+	if err != nil {
+		return nil, fmt.Errorf("error cloning git repository %s: %w", url, err)
+	}
+
+	if ref == "" {
+		head, err := repo.Head()
+		if err != nil {
+			return nil, fmt.Errorf("error finding default branch of %s: %w", url, err)
+		}
+		ref = head.Name().Short()
+	}
+
+	return &GitSource{repo: repo, ref: ref, path: path}, nil
+}
+
+// Redirects fetches the repository, and returns the redirects in the file at the
+// configured ref. The file is only parsed again if the commit has changed.
+func (g *GitSource) Redirects() (map[string]*Redirect, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	hash, err := g.update()
+	if err != nil {
+		return nil, err
+	}
+	if hash == g.parsed {
+		g.commit = hash
+		return maps.Clone(g.redirects), nil
+	}
+
+	body, err := g.readFile(hash, g.path)
+	if err != nil {
+		return nil, err
+	} else if body == nil {
+		return nil, fmt.Errorf("file %s not found at commit %s", g.path, hash)
+	}
+
+	slog.Debug("read redirects from git", "commit", hash.String(), "path", g.path)
+	g.commit, g.parsed = hash, hash
+	g.redirects = parseRedirects(string(body))
+	return maps.Clone(g.redirects), nil
+}
+
+// SignedRedirects fetches the repository, and returns the redirects file at the
+// configured ref along with the detached signature committed alongside it, if any.
+func (g *GitSource) SignedRedirects() ([]byte, []byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	hash, err := g.update()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := g.readFile(hash, g.path)
+	if err != nil {
+		return nil, nil, err
+	} else if body == nil {
+		return nil, nil, fmt.Errorf("file %s not found at commit %s", g.path, hash)
+	}
+	sig, err := g.readFile(hash, g.path+signatureSuffix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g.commit = hash
+	return body, sig, nil
+}
+
+// update fetches the repository and returns the commit that the configured ref
+// points to.
+func (g *GitSource) update() (plumbing.Hash, error) {
+	err := g.repo.Fetch(&git.FetchOptions{Tags: git.AllTags, Force: true})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		// Fall back to the last fetched commit, so that the redirects remain available
+		// if the remote is temporarily unreachable
+		slog.Warn("failed to fetch git repository", "error", err.Error())
+	}
+	return g.resolve()
+}
+
+// readFile returns the contents of the file at path in the specified commit, or nil
+// if there is no such file.
+func (g *GitSource) readFile(hash plumbing.Hash, path string) ([]byte, error) {
+	commit, err := g.repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("error reading commit %s: %w", hash, err)
+	}
+	file, err := commit.File(path)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s at commit %s: %w", path, hash, err)
+	}
+	body, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s at commit %s: %w", path, hash, err)
+	}
+	return []byte(body), nil
+}
+
+// resolve returns the commit that the configured ref points to. Branches are resolved
+// using the remote tracking branch, which is updated by each fetch.
+func (g *GitSource) resolve() (plumbing.Hash, error) {
+	for _, rev := range []string{"refs/remotes/origin/" + g.ref, "refs/tags/" + g.ref, g.ref} {
+		hash, err := g.repo.ResolveRevision(plumbing.Revision(rev))
+		if err == nil {
+			return *hash, nil
+		}
+	}
+	return plumbing.ZeroHash, fmt.Errorf("unknown git ref '%s'", g.ref)
+}
+
+// Version returns the hash of the commit from which the redirects were last read.
+func (g *GitSource) Version() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.commit.IsZero() {
+		return ""
+	}
+	return g.commit.String()
+}
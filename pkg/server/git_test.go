@@ -0,0 +1,123 @@
+package server
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gopkg.in/check.v1"
+)
+
+type GitSourceTestSuite struct {
+	dir  string
+	repo *git.Repository
+}
+
+func (s *GitSourceTestSuite) SetUpTest(c *check.C) {
+	s.dir = c.MkDir()
+	repo, err := git.PlainInit(s.dir, false)
+	c.Assert(err, check.IsNil)
+	s.repo = repo
+}
+
+var _ = check.Suite(&GitSourceTestSuite{})
+
+// commit writes a redirects file to the test repository and commits it, returning the
+// hash of the commit
+func (s *GitSourceTestSuite) commit(c *check.C, content string) plumbing.Hash {
+	err := os.WriteFile(path.Join(s.dir, "redirects"), []byte(content), 0644)
+	c.Assert(err, check.IsNil)
+
+	wt, err := s.repo.Worktree()
+	c.Assert(err, check.IsNil)
+	_, err = wt.Add("redirects")
+	c.Assert(err, check.IsNil)
+
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	hash, err := wt.Commit("update redirects", &git.CommitOptions{Author: sig})
+	c.Assert(err, check.IsNil)
+	return hash
+}
+
+// TestGitSourcePollsForCommits tests that redirects are read from the default branch,
+// and that new commits are picked up when the redirects are refreshed
+func (s *GitSourceTestSuite) TestGitSourcePollsForCommits(c *check.C) {
+	first := s.commit(c, "foo http://foo.bar\n")
+
+	src, err := NewGitSource(s.dir, "", "redirects")
+	c.Assert(err, check.IsNil)
+
+	server := NewServerWithSource(nil, src)
+	c.Assert(server.RefreshRedirects(), check.IsNil)
+	c.Assert(server.NumRedirects(), check.Equals, 1)
+	c.Assert(src.Version(), check.Equals, first.String())
+	c.Assert(readGaugeVec(server.metrics.redirectsVersion, first.String()), check.Equals, float64(1))
+
+	second := s.commit(c, "foo http://foo.bar\nbar http://bar.baz\n")
+
+	c.Assert(server.RefreshRedirects(), check.IsNil)
+	c.Assert(server.NumRedirects(), check.Equals, 2)
+	c.Assert(src.Version(), check.Equals, second.String())
+	c.Assert(readGaugeVec(server.metrics.redirectsVersion, second.String()), check.Equals, float64(1))
+	c.Assert(readGaugeVec(server.metrics.redirectsVersion, first.String()), check.Equals, float64(0))
+}
+
+// TestGitSourceRefs tests that redirects can be read at a branch, tag or commit
+func (s *GitSourceTestSuite) TestGitSourceRefs(c *check.C) {
+	first := s.commit(c, "foo http://foo.bar\n")
+	_, err := s.repo.CreateTag("v1", first, nil)
+	c.Assert(err, check.IsNil)
+	s.commit(c, "foo http://foo.baz\n")
+
+	for _, ref := range []string{"v1", first.String()} {
+		src, err := NewGitSource(s.dir, ref, "redirects")
+		c.Assert(err, check.IsNil)
+
+		redirects, err := src.Redirects()
+		c.Assert(err, check.IsNil, check.Commentf(ref))
+		c.Assert(redirects["foo"].URL, check.Equals, "http://foo.bar", check.Commentf(ref))
+		c.Assert(src.Version(), check.Equals, first.String())
+	}
+
+	head, _ := s.repo.Head()
+	src, err := NewGitSource(s.dir, head.Name().Short(), "redirects")
+	c.Assert(err, check.IsNil)
+	redirects, err := src.Redirects()
+	c.Assert(err, check.IsNil)
+	c.Assert(redirects["foo"].URL, check.Equals, "http://foo.baz")
+
+	src, err = NewGitSource(s.dir, "nope", "redirects")
+	c.Assert(err, check.IsNil)
+	_, err = src.Redirects()
+	c.Assert(err, check.ErrorMatches, "unknown git ref 'nope'")
+}
+
+// TestGitSourceBareRepository tests reading redirects from a bare repository
+func (s *GitSourceTestSuite) TestGitSourceBareRepository(c *check.C) {
+	s.commit(c, "foo http://foo.bar\n")
+
+	bare := c.MkDir()
+	_, err := git.PlainClone(bare, true, &git.CloneOptions{URL: s.dir})
+	c.Assert(err, check.IsNil)
+
+	src, err := NewGitSource(bare, "", "redirects")
+	c.Assert(err, check.IsNil)
+	redirects, err := src.Redirects()
+	c.Assert(err, check.IsNil)
+	c.Assert(redirects, check.HasLen, 1)
+}
+
+// TestGitSourceErrors tests that missing repositories and files are reported
+func (s *GitSourceTestSuite) TestGitSourceErrors(c *check.C) {
+	_, err := NewGitSource(path.Join(s.dir, "missing"), "", "redirects")
+	c.Assert(err, check.NotNil)
+
+	hash := s.commit(c, "foo http://foo.bar\n")
+	src, err := NewGitSource(s.dir, "", "other")
+	c.Assert(err, check.IsNil)
+	_, err = src.Redirects()
+	c.Assert(err, check.ErrorMatches, "file other not found at commit "+hash.String())
+}
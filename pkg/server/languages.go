@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"golang.org/x/text/language"
+)
+
+// validateLanguages checks that the keys of a language map are valid BCP 47 tags,
+// and that the destinations are valid URLs.
+func validateLanguages(languages map[string]string) error {
+	for tag, u := range languages {
+		if _, err := language.Parse(tag); err != nil {
+			return fmt.Errorf("invalid language tag '%s'", tag)
+		}
+		if err := validateURL(u); err != nil {
+			return fmt.Errorf("language '%s': %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// matchLanguage returns the destination whose language best matches an Accept-Language
+// header, using quality values to order the client's preferences. The redirect's own
+// URL is a candidate in the default language, unless that language has a destination
+// of its own, so that clients who prefer it are not sent to another language. If none
+// of the languages are an acceptable match, or the default language is the best match,
+// false is returned. A default language of language.Und disables this.
+func matchLanguage(languages map[string]string, acceptLanguage string, defaultLanguage language.Tag) (string, bool) {
+	prefs, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(prefs) == 0 {
+		return "", false
+	}
+
+	// Sort the tags so that matching is deterministic when confidence is equal
+	keys := slices.Sorted(maps.Keys(languages))
+	tags := make([]language.Tag, 0, len(keys)+1)
+	for _, k := range keys {
+		tags = append(tags, language.Make(k))
+	}
+
+	// The default language is the first candidate, so it wins when confidence is equal
+	offset := 0
+	if defaultLanguage != language.Und && !slices.Contains(tags, defaultLanguage) {
+		tags = slices.Insert(tags, 0, defaultLanguage)
+		offset = 1
+	}
+
+	_, i, confidence := language.NewMatcher(tags).Match(prefs...)
+	if confidence == language.No || i < offset {
+		return "", false
+	}
+	return languages[keys[i-offset]], true
+}
+
+// ConfigureDefaultLanguage sets the language of the URLs of redirects with language
+// specific destinations, which is English by default. Clients who prefer the default
+// language are sent to the redirect's URL. The tag "und" leaves the language of the
+// URLs undetermined, so clients are sent to the best matching language specific
+// destination instead.
+func (s *Server) ConfigureDefaultLanguage(tag string) error {
+	t, err := language.Parse(tag)
+	if err != nil {
+		return fmt.Errorf("invalid language tag '%s'", tag)
+	}
+	s.defaultLanguage = t
+	return nil
+}
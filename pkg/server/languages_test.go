@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net/http/httptest"
+
+	"golang.org/x/text/language"
+	"gopkg.in/check.v1"
+)
+
+type LanguagesTestSuite struct{}
+
+var _ = check.Suite(&LanguagesTestSuite{})
+
+// TestMatchLanguage tests negotiation of destinations with Accept-Language headers
+func (s *LanguagesTestSuite) TestMatchLanguage(c *check.C) {
+	languages := map[string]string{
+		"en":    "http://docs/en",
+		"de":    "http://docs/de",
+		"fr":    "http://docs/fr",
+		"pt-BR": "http://docs/pt-br",
+	}
+
+	var tests = []struct {
+		header string
+		url    string
+		ok     bool
+	}{
+		{"de", "http://docs/de", true},
+		{"de-AT", "http://docs/de", true},
+		{"fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", "http://docs/fr", true},
+		{"en;q=0.5, de;q=0.9", "http://docs/de", true},
+		{"ja, de;q=0.3", "http://docs/de", true},
+		{"pt-BR", "http://docs/pt-br", true},
+		{"pt-PT", "http://docs/pt-br", true},
+		{"ja", "", false},
+		{"", "", false},
+		{"not a header;;", "", false},
+	}
+
+	for _, t := range tests {
+		url, ok := matchLanguage(languages, t.header, language.English)
+		c.Assert(ok, check.Equals, t.ok, check.Commentf("%s", t.header))
+		c.Assert(url, check.Equals, t.url, check.Commentf("%s", t.header))
+	}
+}
+
+// TestMatchLanguageDefault tests that the redirect's URL is chosen when the client
+// prefers the default language to the language specific destinations
+func (s *LanguagesTestSuite) TestMatchLanguageDefault(c *check.C) {
+	languages := map[string]string{"de": "http://docs/de"}
+
+	var tests = []struct {
+		header   string
+		language language.Tag
+		url      string
+		ok       bool
+	}{
+		{"en;q=1, de;q=0.5", language.English, "", false},
+		{"en-GB, de;q=0.5", language.English, "", false},
+		{"de, en;q=0.5", language.English, "http://docs/de", true},
+		{"ja, de;q=0.3", language.English, "http://docs/de", true},
+		{"fr;q=1, de;q=0.5", language.French, "", false},
+		{"en;q=1, de;q=0.5", language.Und, "http://docs/de", true},
+	}
+
+	for _, t := range tests {
+		url, ok := matchLanguage(languages, t.header, t.language)
+		c.Assert(ok, check.Equals, t.ok, check.Commentf("%s", t.header))
+		c.Assert(url, check.Equals, t.url, check.Commentf("%s", t.header))
+	}
+}
+
+// TestParseLanguages tests that language specific destinations are parsed and validated
+func (s *LanguagesTestSuite) TestParseLanguages(c *check.C) {
+	redirects := parseRedirects(`
+docs http://docs/en lang=de,http://docs/de lang=pt-BR,http://docs/pt-br
+badtag http://docs/en lang=not_a_tag!,http://docs/de
+`)
+
+	c.Assert(redirects, check.HasLen, 1)
+	c.Assert(redirects["docs"].Languages, check.DeepEquals, map[string]string{
+		"de":    "http://docs/de",
+		"pt-BR": "http://docs/pt-br",
+	})
+}
+
+// TestRouteHandlerLanguages tests that requests are redirected according to their
+// Accept-Language header, falling back to the redirect URL
+func (s *LanguagesTestSuite) TestRouteHandlerLanguages(c *check.C) {
+	store := NewMemoryStore()
+	store.Put(&Redirect{Alias: "docs", URL: "http://docs/en", Languages: map[string]string{
+		"de": "http://docs/de",
+	}})
+	server := NewServerWithSource(nil, store)
+
+	for header, location := range map[string]string{
+		"de-DE,de;q=0.9": "http://docs/de",
+		"en-GB":          "http://docs/en",
+		"en, de;q=0.5":   "http://docs/en",
+		"":               "http://docs/en",
+	} {
+		req := httptest.NewRequest("GET", "/docs", nil)
+		req.Header.Set("Accept-Language", header)
+		rr := httptest.NewRecorder()
+		server.routeHandler(rr, req)
+
+		c.Assert(rr.Header().Get("Location"), check.Equals, location)
+		c.Assert(rr.Header().Get("Vary"), check.Equals, "Accept-Language")
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jnsgruk/gosherve/pkg/logging"
+)
+
+// linksPath is the path of the public directory of redirects
+const linksPath = "/-/links"
+
+// linksTemplateFile is the name of the link directory template, which may be overridden
+// by a file of the same name in the webroot
+const linksTemplateFile = "links.html"
+
+// linkView is the public representation of a redirect in the link directory. The
+// destinations of password protected and limited-use redirects are omitted, so that
+// they cannot be followed without a password or consuming a click.
+type linkView struct {
+	Alias       string   `json:"alias"`
+	URL         string   `json:"url,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Protected   bool     `json:"protected,omitempty"`
+	Limited     bool     `json:"limited,omitempty"`
+}
+
+// linksData is passed to the link directory template
+type linksData struct {
+	Links []linkView
+	// Tags lists every tag of the listed redirects, to allow filtering by tag
+	Tags  []string
+	Tag   string
+	Query string
+}
+
+// validateTags checks that tags are non-empty, unique and safe to use in URLs.
+func validateTags(tags []string) error {
+	for i, t := range tags {
+		if t == "" {
+			return fmt.Errorf("tag must not be empty")
+		}
+		if strings.IndexFunc(t, invalidNameRune) >= 0 {
+			return fmt.Errorf("tag '%s' may only contain letters, digits, '-' and '_'", t)
+		}
+		if slices.Contains(tags[:i], t) {
+			return fmt.Errorf("duplicate tag '%s'", t)
+		}
+	}
+	return nil
+}
+
+// handleLinks serves a directory of the active redirects which are not hidden, as an
+// HTML page or, if requested with "format=json" or an Accept header of
+// "application/json", as JSON. Links can be filtered by tag with the "tag" query
+// parameter, and searched with the "q" query parameter.
+func handleLinks(w http.ResponseWriter, r *http.Request, s *Server) bool {
+	l := logging.GetLoggerFromCtx(r.Context())
+
+	if strings.TrimSuffix(r.URL.Path, "/") != linksPath {
+		return false
+	}
+
+	query := r.URL.Query()
+	data := linksData{Links: []linkView{}, Tag: query.Get("tag"), Query: strings.TrimSpace(query.Get("q"))}
+
+	links, tags := s.directory()
+	data.Tags = tags
+	for _, link := range links {
+		if data.Tag != "" && !slices.Contains(link.Tags, data.Tag) {
+			continue
+		}
+		if data.Query != "" && !link.matches(data.Query) {
+			continue
+		}
+		data.Links = append(data.Links, link)
+	}
+
+	setOutcome(w, outcomeRedirect)
+	if wantsJSON(r) {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, data.Links)
+		s.metrics.responseStatus.WithLabelValues(strconv.Itoa(http.StatusOK)).Inc()
+	} else if !renderTemplate(w, r, s, http.StatusOK, linksTemplateFile, data) {
+		return true
+	}
+
+	l.Info("served link directory", slog.Group("response", "status_code", http.StatusOK, "links", len(data.Links)))
+	return true
+}
+
+// wantsJSON reports whether a page was requested as JSON, with "format=json" or an
+// Accept header of "application/json".
+func wantsJSON(r *http.Request) bool {
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "application/json") {
+		format = "json"
+	}
+	return format == "json"
+}
+
+// directory returns the redirects which are listed in the link directory, sorted by
+// alias, along with the sorted set of their tags.
+func (s *Server) directory() ([]linkView, []string) {
+	s.mu.RLock()
+	redirects := make([]*Redirect, 0, len(s.redirects))
+	for _, rd := range s.redirects {
+		if !rd.Hidden {
+			redirects = append(redirects, rd)
+		}
+	}
+	s.mu.RUnlock()
+
+	links := []linkView{}
+	tags := []string{}
+	for _, rd := range redirects {
+		// Redirects which are not yet active, or have expired, are not listed
+		if _, err := s.activeRedirect(rd.Alias); err != nil {
+			continue
+		}
+
+		link := linkView{Alias: rd.Alias, Description: rd.Description, Tags: rd.Tags}
+		switch {
+		case rd.PasswordHash != "":
+			link.Protected = true
+		case rd.MaxClicks > 0:
+			link.Limited = true
+		default:
+			link.URL = rd.Destination(s.now())
+		}
+		links = append(links, link)
+		tags = append(tags, rd.Tags...)
+	}
+
+	slices.SortFunc(links, func(a, b linkView) int { return strings.Compare(a.Alias, b.Alias) })
+	slices.Sort(tags)
+	return links, slices.Compact(tags)
+}
+
+// matches reports whether a link's alias, destination, description or tags contain
+// the query, ignoring case.
+func (l linkView) matches(query string) bool {
+	query = strings.ToLower(query)
+	fields := append([]string{l.Alias, l.URL, l.Description}, l.Tags...)
+	return slices.ContainsFunc(fields, func(f string) bool { return strings.Contains(strings.ToLower(f), query) })
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type LinksTestSuite struct {
+	server *Server
+}
+
+func (s *LinksTestSuite) SetUpTest(c *check.C) {
+	expired := time.Now().Add(-time.Hour)
+	store := NewMemoryStore()
+	store.Put(&Redirect{Alias: "docs", URL: "http://docs.bar", Description: "Team docs", Tags: []string{"eng", "wiki"}})
+	store.Put(&Redirect{Alias: "cal", URL: "http://cal.bar", Tags: []string{"team"}})
+	store.Put(&Redirect{Alias: "secret", URL: "http://secret.bar", Hidden: true})
+	store.Put(&Redirect{Alias: "old", URL: "http://old.bar", NotAfter: &expired})
+	store.Put(&Redirect{Alias: "invite", URL: "http://invite.bar", MaxClicks: 1})
+	store.Put(&Redirect{Alias: "vpn", URL: "http://vpn.bar", PasswordHash: "$2a$04$abcdefghijklmnopqrstuu5Wc9vDdVvH7Gl6wWFnIsfO1oq3dg.C2"})
+
+	s.server = NewServerWithSource(nil, store)
+	s.server.RefreshRedirects()
+}
+
+var _ = check.Suite(&LinksTestSuite{})
+
+// requestLinks requests the link directory as JSON, returning the decoded links
+func requestLinks(c *check.C, s *Server, target string) []linkView {
+	req := httptest.NewRequest("GET", target, nil)
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	s.routeHandler(rr, req)
+
+	c.Assert(rr.Code, check.Equals, http.StatusOK)
+	c.Assert(rr.Header().Get("Content-Type"), check.Equals, "application/json")
+
+	links := []linkView{}
+	c.Assert(json.Unmarshal(rr.Body.Bytes(), &links), check.IsNil)
+	return links
+}
+
+// TestLinksJSON tests that active redirects which are not hidden are listed, without
+// revealing the destinations of password protected or limited-use redirects
+func (s *LinksTestSuite) TestLinksJSON(c *check.C) {
+	links := requestLinks(c, s.server, "/-/links")
+
+	c.Assert(links, check.DeepEquals, []linkView{
+		{Alias: "cal", URL: "http://cal.bar", Tags: []string{"team"}},
+		{Alias: "docs", URL: "http://docs.bar", Description: "Team docs", Tags: []string{"eng", "wiki"}},
+		{Alias: "invite", Limited: true},
+		{Alias: "vpn", Protected: true},
+	})
+}
+
+// TestLinksFilter tests filtering links by tag and substring search
+func (s *LinksTestSuite) TestLinksFilter(c *check.C) {
+	links := requestLinks(c, s.server, "/-/links?tag=wiki")
+	c.Assert(links, check.HasLen, 1)
+	c.Assert(links[0].Alias, check.Equals, "docs")
+
+	// Searches match aliases, destinations, descriptions and tags, ignoring case
+	links = requestLinks(c, s.server, "/-/links?q=TEAM")
+	c.Assert(links, check.HasLen, 2)
+
+	links = requestLinks(c, s.server, "/-/links?q=cal.bar")
+	c.Assert(links, check.HasLen, 1)
+
+	links = requestLinks(c, s.server, "/-/links?q=team&tag=eng")
+	c.Assert(links, check.HasLen, 1)
+
+	// Protected and limited-use destinations are not searchable
+	links = requestLinks(c, s.server, "/-/links?q=vpn.bar")
+	c.Assert(links, check.HasLen, 0)
+	links = requestLinks(c, s.server, "/-/links?q=invite.bar")
+	c.Assert(links, check.HasLen, 0)
+}
+
+// TestLinksHTML tests that the link directory is rendered as HTML by default
+func (s *LinksTestSuite) TestLinksHTML(c *check.C) {
+	body, code := requestRoute(s.server, "/-/links/")
+
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Matches, `(?s).*<a href="/docs">docs</a>.*`)
+	c.Assert(body, check.Matches, `(?s).*<a href="\?tag=team&q=".*`)
+	c.Assert(body, check.Not(check.Matches), `(?s).*secret.*`)
+	c.Assert(body, check.Not(check.Matches), `(?s).*vpn\.bar.*`)
+	c.Assert(body, check.Not(check.Matches), `(?s).*invite\.bar.*`)
+	c.Assert(body, check.Matches, `(?s).*Limited use.*`)
+
+	body, _ = requestRoute(s.server, "/-/links?q=nothing")
+	c.Assert(body, check.Matches, `(?s).*No links found.*`)
+}
+
+// TestLinksAttributes tests parsing and validation of the hidden and tags attributes
+func (s *LinksTestSuite) TestLinksAttributes(c *check.C) {
+	redirects := parseRedirects("a http://a.com hidden=true tags=x,y tags=z\nb http://b.com tags=x,x\nc http://c.com tags=a/b\n")
+
+	c.Assert(redirects, check.HasLen, 1)
+	c.Assert(redirects["a"].Hidden, check.Equals, true)
+	c.Assert(redirects["a"].Tags, check.DeepEquals, []string{"x", "y", "z"})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/logging"
+)
+
+// listingMarkerFile is the name of a file which enables directory listings for the
+// directory containing it, when listings are not enabled for the whole webroot
+const listingMarkerFile = ".gosherve-listing"
+
+// listingTemplateFile is the name of the directory listing template, which may be
+// overridden by a file of the same name in the webroot
+const listingTemplateFile = "listing.html"
+
+// listingEntry is a file or directory in a directory listing
+type listingEntry struct {
+	Name     string    `json:"name"`
+	Dir      bool      `json:"dir,omitempty"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// listingData is passed to the directory listing template
+type listingData struct {
+	// Path is the URL path of the directory, with a trailing slash
+	Path string
+	// Parent is the URL path of the parent directory, or empty for the webroot
+	Parent  string
+	Entries []listingEntry
+}
+
+// ConfigureDirectoryListing enables listings of directories in the webroot which do
+// not contain an index.html. Otherwise, only directories containing a
+// .gosherve-listing file are listed.
+func (s *Server) ConfigureDirectoryListing(enabled bool) {
+	s.directoryListing = enabled
+}
+
+// hidden reports whether any element of a path in the webroot is hidden, by beginning
+// with a dot. Hidden files are neither listed nor served. The .well-known directory is
+// not hidden, since it holds files which are meant to be served, such as security.txt.
+func hidden(name string) bool {
+	return slices.ContainsFunc(strings.Split(name, "/"), func(e string) bool {
+		return strings.HasPrefix(e, ".") && e != "." && e != ".well-known"
+	})
+}
+
+// handleListing serves a listing of a directory in the webroot without an index.html,
+// if listings are enabled for it, as an HTML page or, if requested with "format=json"
+// or an Accept header of "application/json", as JSON. Hidden files and directories,
+// and templates overriding the built-in pages, are never listed.
+func handleListing(w http.ResponseWriter, r *http.Request, s *Server, dir string) bool {
+	l := logging.GetLoggerFromCtx(r.Context())
+
+	if hidden(dir) {
+		return false
+	}
+	if !s.directoryListing {
+		if _, err := fs.Stat(*s.webroot, path.Join(dir, listingMarkerFile)); err != nil {
+			return false
+		}
+	}
+
+	entries, err := fs.ReadDir(*s.webroot, dir)
+	if err != nil {
+		l.Error("failed to read directory", "directory", dir, "error", err.Error())
+		return false
+	}
+
+	data := listingData{Path: "/", Entries: []listingEntry{}}
+	if dir != "." {
+		data.Path = "/" + dir + "/"
+		data.Parent = strings.TrimSuffix(path.Dir("/"+dir), "/") + "/"
+	}
+
+	for _, e := range entries {
+		if hidden(e.Name()) || dir == "." && isTemplateOverride(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		entry := listingEntry{Name: e.Name(), Dir: e.IsDir(), Modified: fi.ModTime().UTC()}
+		if !e.IsDir() {
+			entry.Size = fi.Size()
+		}
+		data.Entries = append(data.Entries, entry)
+	}
+
+	// Directories are listed before files
+	slices.SortStableFunc(data.Entries, func(a, b listingEntry) int {
+		if a.Dir != b.Dir && a.Dir {
+			return -1
+		} else if a.Dir != b.Dir {
+			return 1
+		}
+		return 0
+	})
+
+	setOutcome(w, outcomeFile)
+	if wantsJSON(r) {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, data.Entries)
+		s.metrics.responseStatus.WithLabelValues(strconv.Itoa(http.StatusOK)).Inc()
+	} else if !renderTemplate(w, r, s, http.StatusOK, listingTemplateFile, data) {
+		return true
+	}
+
+	l.Info("served directory listing", slog.Group("response", "status_code", http.StatusOK, "directory", data.Path, "entries", len(data.Entries)))
+	return true
+}
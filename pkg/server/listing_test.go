@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type ListingTestSuite struct {
+	server *Server
+}
+
+var _ = check.Suite(&ListingTestSuite{})
+
+func (s *ListingTestSuite) SetUpTest(c *check.C) {
+	modified := time.Date(2026, 3, 2, 12, 30, 0, 0, time.UTC)
+	var webroot fs.FS = fstest.MapFS{
+		"files/report.pdf":                {Data: []byte("report"), ModTime: modified},
+		"files/notes.txt":                 {Data: []byte("notes"), ModTime: modified},
+		"files/.secret":                   {Data: []byte("secret")},
+		"files/archive/old.txt":           {Data: []byte("old")},
+		"files/.git/config":               {Data: []byte("config")},
+		"site/index.html":                 {Data: []byte("site")},
+		"marked/.gosherve-listing":        {Data: []byte{}},
+		"marked/photo.jpg":                {Data: []byte("photo")},
+		"files/.hidden/visible.txt":       {Data: []byte("visible")},
+		"files/.hidden/.gosherve-listing": {Data: []byte{}},
+		".well-known/security.txt":        {Data: []byte("contact")},
+	}
+
+	store := NewMemoryStore()
+	store.Put(&Redirect{Alias: "files", URL: "http://files.com"})
+	s.server = NewServerWithSource(&webroot, store)
+	s.server.RefreshRedirects()
+}
+
+// request requests a path with the specified Accept header
+func (s *ListingTestSuite) request(path string, accept string) *http.Response {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Accept", accept)
+	rr := httptest.NewRecorder()
+	s.server.routeHandler(rr, req)
+	return rr.Result()
+}
+
+// TestListingDisabled tests that directories without an index.html fall through to
+// redirects unless listings are enabled
+func (s *ListingTestSuite) TestListingDisabled(c *check.C) {
+	res := s.request("/files/", "")
+	c.Assert(res.StatusCode, check.Equals, http.StatusMovedPermanently)
+	c.Assert(res.Header.Get("Location"), check.Equals, "http://files.com")
+
+	c.Assert(s.request("/files/archive", "").StatusCode, check.Equals, http.StatusNotFound)
+}
+
+// TestListingJSON tests that directories are listed as JSON, with directories before
+// files and hidden files omitted
+func (s *ListingTestSuite) TestListingJSON(c *check.C) {
+	s.server.ConfigureDirectoryListing(true)
+
+	res := s.request("/files", "application/json")
+	c.Assert(res.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(res.Header.Get("Content-Type"), check.Equals, "application/json")
+
+	var entries []listingEntry
+	c.Assert(json.NewDecoder(res.Body).Decode(&entries), check.IsNil)
+	c.Assert(entries, check.DeepEquals, []listingEntry{
+		{Name: "archive", Dir: true},
+		{Name: "notes.txt", Size: 5, Modified: time.Date(2026, 3, 2, 12, 30, 0, 0, time.UTC)},
+		{Name: "report.pdf", Size: 6, Modified: time.Date(2026, 3, 2, 12, 30, 0, 0, time.UTC)},
+	})
+
+	// Directories with an index.html are served as usual
+	body, _ := io.ReadAll(s.request("/site/", "").Body)
+	c.Assert(string(body), check.Equals, "site")
+}
+
+// TestListingHTML tests that directories are listed as an HTML page with links to each
+// entry and the parent directory
+func (s *ListingTestSuite) TestListingHTML(c *check.C) {
+	s.server.ConfigureDirectoryListing(true)
+
+	res := s.request("/files/archive/", "text/html")
+	c.Assert(res.StatusCode, check.Equals, http.StatusOK)
+	body, _ := io.ReadAll(res.Body)
+	c.Assert(string(body), check.Matches, `(?s).*Index of /files/archive/.*href="/files/".*href="/files/archive/old.txt".*`)
+
+	body, _ = io.ReadAll(s.request("/", "").Body)
+	c.Assert(string(body), check.Matches, `(?s).*href="/files/">files/<.*`)
+	c.Assert(string(body), check.Not(check.Matches), `(?s).*\.\./.*`)
+}
+
+// TestListingMarker tests that only directories containing a marker file are listed
+// when listings are not enabled for the whole webroot
+func (s *ListingTestSuite) TestListingMarker(c *check.C) {
+	res := s.request("/marked/", "application/json")
+	c.Assert(res.StatusCode, check.Equals, http.StatusOK)
+
+	var entries []listingEntry
+	c.Assert(json.NewDecoder(res.Body).Decode(&entries), check.IsNil)
+	c.Assert(entries, check.HasLen, 1)
+	c.Assert(entries[0].Name, check.Equals, "photo.jpg")
+}
+
+// TestListingHidden tests that hidden directories are never listed, and hidden files are
+// never served, except for those in .well-known
+func (s *ListingTestSuite) TestListingHidden(c *check.C) {
+	s.server.ConfigureDirectoryListing(true)
+	for _, path := range []string{
+		"/files/.git/", "/files/.hidden/", "/files/.secret", "/files/.git/config",
+		"/files/.hidden/visible.txt", "/marked/.gosherve-listing",
+	} {
+		c.Assert(s.request(path, "").StatusCode, check.Equals, http.StatusNotFound, check.Commentf(path))
+	}
+
+	body, _ := io.ReadAll(s.request("/.well-known/security.txt", "").Body)
+	c.Assert(string(body), check.Equals, "contact")
+}
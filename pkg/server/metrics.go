@@ -1,18 +1,63 @@
 package server
 
 import (
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// otherAlias is the alias label under which redirects are counted once the number of
+// aliases with their own series has reached the configured limit, or if they are
+// not in the configured allowlist. It is reserved, so it cannot be the label of a
+// real alias.
+const otherAlias = "other"
+
+// Outcomes label the request duration and response size metrics with the kind of
+// response that was served. Pages describing redirects, such as previews, QR codes,
+// password forms and the link directory, are counted as redirects, and directory
+// listings as files.
+const (
+	outcomeFile     = "file"
+	outcomeRedirect = "redirect"
+	outcomeNotFound = "not_found"
+	outcomeError    = "error"
+)
+
+// methodLabels are the request methods which have their own series in the request
+// duration and response size metrics. Any other method is counted as "other", so that
+// clients cannot create arbitrary series.
+var methodLabels = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
 type metrics struct {
-	requestsTotal    prometheus.Counter
-	redirectsServed  *prometheus.CounterVec
-	redirectsDefined prometheus.Gauge
-	responseStatus   *prometheus.CounterVec
+	requestsTotal     prometheus.Counter
+	redirectsServed   *prometheus.CounterVec
+	redirectsDefined  prometheus.Gauge
+	redirectsVersion  *prometheus.GaugeVec
+	redirectsRejected prometheus.Counter
+	responseStatus    *prometheus.CounterVec
+	requestDuration   *prometheus.HistogramVec
+	responseBytes     *prometheus.CounterVec
+
+	aliasesMu       sync.Mutex
+	aliases         map[string]bool
+	unlistedAliases int
+	maxAliases      int
+	allowedAliases  map[string]bool
 }
 
-func newMetrics(reg *prometheus.Registry) *metrics {
+func newMetrics(reg prometheus.Registerer) *metrics {
 	return &metrics{
 		requestsTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Namespace: "gosherve",
@@ -22,17 +67,172 @@ func newMetrics(reg *prometheus.Registry) *metrics {
 		redirectsServed: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Namespace: "gosherve",
 			Name:      "redirects_served",
-			Help:      "The number of requests per redirect",
-		}, []string{"alias"}),
+			Help:      "The number of requests per redirect, and per variant for split redirects",
+		}, []string{"alias", "variant"}),
 		redirectsDefined: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
 			Namespace: "gosherve",
 			Name:      "redirects_defined",
 			Help:      "The number of redirects defined",
 		}),
+		redirectsVersion: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "gosherve",
+			Name:      "redirects_version",
+			Help:      "Set to 1 for the version of the loaded redirects, such as a commit hash",
+		}, []string{"version"}),
+		redirectsRejected: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace: "gosherve",
+			Name:      "redirects_rejected_total",
+			Help:      "The number of times redirects were rejected because they were not correctly signed",
+		}),
 		responseStatus: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Namespace: "gosherve",
 			Name:      "response_status",
 			Help:      "The status codes of HTTP responses",
 		}, []string{"status"}),
+		requestDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "gosherve",
+			Name:      "request_duration_seconds",
+			Help:      "The time taken to serve HTTP requests, by outcome and method",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"outcome", "method"}),
+		responseBytes: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gosherve",
+			Name:      "response_bytes_total",
+			Help:      "The number of bytes written in HTTP response bodies, by outcome and method",
+		}, []string{"outcome", "method"}),
+		aliases: map[string]bool{},
+	}
+}
+
+// aliasLabel returns the alias label under which a redirect is counted. Aliases in the
+// allowlist always have their own series. Other aliases have their own series until
+// the limit is reached, or if there is an allowlist and no limit, are counted under
+// otherAlias. Without an allowlist or limit, every alias has its own series.
+func (m *metrics) aliasLabel(alias string) string {
+	m.aliasesMu.Lock()
+	defer m.aliasesMu.Unlock()
+
+	if m.aliases[alias] {
+		return alias
+	}
+	if !m.allowedAliases[alias] {
+		if m.maxAliases > 0 && m.unlistedAliases >= m.maxAliases || m.maxAliases == 0 && len(m.allowedAliases) > 0 {
+			return otherAlias
+		}
+		m.unlistedAliases++
+	}
+	m.aliases[alias] = true
+	return alias
+}
+
+// configureAliases sets the limit on the number of aliases which are not in the
+// allowlist that may have their own series.
+func (m *metrics) configureAliases(max int, allowlist []string) {
+	m.aliasesMu.Lock()
+	defer m.aliasesMu.Unlock()
+
+	m.maxAliases = max
+	m.allowedAliases = map[string]bool{}
+	for _, alias := range allowlist {
+		m.allowedAliases[alias] = true
+	}
+
+	m.unlistedAliases = 0
+	for alias := range m.aliases {
+		if !m.allowedAliases[alias] {
+			m.unlistedAliases++
+		}
+	}
+}
+
+// removeAliases deletes the series of aliases which are no longer defined, so that
+// they are not exported forever, and frees their place under the limit.
+func (m *metrics) removeAliases(defined func(alias string) bool) {
+	m.aliasesMu.Lock()
+	defer m.aliasesMu.Unlock()
+
+	for alias := range maps.Clone(m.aliases) {
+		if defined(alias) {
+			continue
+		}
+		m.redirectsServed.DeletePartialMatch(prometheus.Labels{"alias": alias})
+		delete(m.aliases, alias)
+		if !m.allowedAliases[alias] {
+			m.unlistedAliases--
+		}
+	}
+}
+
+// instrument is a middleware that observes the duration and size of each response in
+// the request duration and response size metrics.
+func (s *Server) instrument(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rw, r)
+
+		method := r.Method
+		if !methodLabels[method] {
+			method = "other"
+		}
+		outcome := rw.outcomeLabel()
+		s.metrics.requestDuration.WithLabelValues(outcome, method).Observe(time.Since(start).Seconds())
+		s.metrics.responseBytes.WithLabelValues(outcome, method).Add(float64(rw.bytes))
+	}
+}
+
+// responseRecorder is an http.ResponseWriter which records the status code and size of
+// a response, along with its outcome if set by the handler that served it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	outcome     string
+	wroteHeader bool
+}
+
+// WriteHeader records the status code of the response before writing it.
+func (rw *responseRecorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the number of bytes written to the response body.
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter, for use by http.ResponseController.
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// outcomeLabel returns the outcome of the response. 404 and 410 responses are counted
+// as not found, and other client and server errors as errors, whichever handler served
+// them. Otherwise the outcome set by the handler is used, and responses whose handler
+// set no outcome are counted as errors.
+func (rw *responseRecorder) outcomeLabel() string {
+	switch {
+	case rw.status == http.StatusNotFound || rw.status == http.StatusGone:
+		return outcomeNotFound
+	case rw.status >= http.StatusBadRequest:
+		return outcomeError
+	case rw.outcome != "":
+		return rw.outcome
+	default:
+		return outcomeError
+	}
+}
+
+// setOutcome sets the outcome of a response, if it is being recorded.
+func setOutcome(w http.ResponseWriter, outcome string) {
+	if rw, ok := w.(*responseRecorder); ok {
+		rw.outcome = outcome
 	}
 }
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/check.v1"
+)
+
+type MetricsTestSuite struct {
+	server *Server
+	store  *MemoryStore
+}
+
+func (s *MetricsTestSuite) SetUpTest(c *check.C) {
+	s.store = NewMemoryStore()
+	for _, alias := range []string{"a", "b", "c", "d"} {
+		s.store.Put(&Redirect{Alias: alias, URL: "http://" + alias + ".com"})
+	}
+	s.server = NewServerWithSource(nil, s.store)
+	s.server.RefreshRedirects()
+}
+
+var _ = check.Suite(&MetricsTestSuite{})
+
+// servedSeries returns the number of redirects served for each alias label
+func (s *MetricsTestSuite) servedSeries(c *check.C) map[string]float64 {
+	ch := make(chan prometheus.Metric, 100)
+	s.server.metrics.redirectsServed.Collect(ch)
+	close(ch)
+
+	series := map[string]float64{}
+	for m := range ch {
+		pb := &dto.Metric{}
+		c.Assert(m.Write(pb), check.IsNil)
+		for _, l := range pb.GetLabel() {
+			if l.GetName() == "alias" {
+				series[l.GetValue()] += pb.GetCounter().GetValue()
+			}
+		}
+	}
+	return series
+}
+
+// serve requests each of the specified aliases
+func (s *MetricsTestSuite) serve(aliases ...string) {
+	for _, alias := range aliases {
+		requestRoute(s.server, "/"+alias)
+	}
+}
+
+// TestMetricsRemovedAliases tests that the series of aliases which are removed from
+// the source or deleted are removed
+func (s *MetricsTestSuite) TestMetricsRemovedAliases(c *check.C) {
+	s.serve("a", "b", "c")
+	c.Assert(s.servedSeries(c), check.DeepEquals, map[string]float64{"a": 1, "b": 1, "c": 1})
+
+	s.store.Delete("a")
+	c.Assert(s.server.RefreshRedirects(), check.IsNil)
+	c.Assert(s.servedSeries(c), check.DeepEquals, map[string]float64{"b": 1, "c": 1})
+
+	s.server.deleteRedirect("b")
+	c.Assert(s.servedSeries(c), check.DeepEquals, map[string]float64{"c": 1})
+}
+
+// TestMetricsAliasLimit tests that aliases beyond the limit are counted as "other", and
+// that removing an alias frees its place
+func (s *MetricsTestSuite) TestMetricsAliasLimit(c *check.C) {
+	s.server.ConfigureMetricAliases(2, nil)
+
+	s.serve("a", "b", "c", "d", "a")
+	c.Assert(s.servedSeries(c), check.DeepEquals, map[string]float64{"a": 2, "b": 1, otherAlias: 2})
+
+	s.store.Delete("a")
+	c.Assert(s.server.RefreshRedirects(), check.IsNil)
+	s.serve("c", "d")
+	c.Assert(s.servedSeries(c), check.DeepEquals, map[string]float64{"b": 1, "c": 1, otherAlias: 3})
+}
+
+// TestMetricsOtherAlias tests that the alias under which other aliases are counted is
+// reserved, so that it cannot be confused with a real alias
+func (s *MetricsTestSuite) TestMetricsOtherAlias(c *check.C) {
+	c.Assert(parseRedirects("other http://other.com\nfoo http://foo.com\n"), check.HasLen, 1)
+
+	body, code := requestAdmin(s.server, "POST", "/api/redirects", `{"alias":"other","url":"http://other.com"}`)
+	c.Assert(code, check.Equals, http.StatusBadRequest)
+	c.Assert(strings.TrimSpace(body), check.Equals, `{"error":"alias 'other' is reserved"}`)
+}
+
+// TestMetricsAliasAllowlist tests that only allowlisted aliases have their own series
+// unless a limit is also configured
+func (s *MetricsTestSuite) TestMetricsAliasAllowlist(c *check.C) {
+	s.server.ConfigureMetricAliases(0, []string{"c"})
+	s.serve("a", "b", "c")
+	c.Assert(s.servedSeries(c), check.DeepEquals, map[string]float64{"c": 1, otherAlias: 2})
+
+	s.server.ConfigureMetricAliases(1, []string{"c", "d"})
+	s.serve("a", "b", "c", "d")
+	c.Assert(s.servedSeries(c), check.DeepEquals, map[string]float64{"a": 1, "c": 2, "d": 1, otherAlias: 3})
+}
+
+// TestMetricsResponseOutcomes tests that the duration and size of responses are
+// observed by their outcome and method, and that client errors are not counted as
+// redirects
+func (s *MetricsTestSuite) TestMetricsResponseOutcomes(c *check.C) {
+	var webroot fs.FS = fstest.MapFS{"index.html": {Data: []byte("hello")}}
+	s.server.webroot = &webroot
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	s.store.Put(&Redirect{Alias: "secret", URL: "http://secret.com", PasswordHash: string(hash)})
+	s.server.RefreshRedirects()
+
+	handler := s.server.instrument(s.server.routeHandler)
+	for _, r := range []struct{ method, path string }{
+		{"GET", "/"}, {"HEAD", "/"}, {"GET", "/a"}, {"GET", "/a"}, {"GET", "/missing"}, {"BREW", "/a"},
+		{"GET", "/a+"}, {"GET", "/-/qr/a"}, {"GET", "/-/qr/a?size=1"}, {"GET", "/secret"},
+	} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(r.method, r.path, nil))
+	}
+
+	// Client errors are counted as errors: the last wrong password is throttled with a 429
+	var code int
+	for range maxPasswordFailures + 1 {
+		req := httptest.NewRequest("POST", "/secret", strings.NewReader("password=wrong"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		code = rec.Code
+	}
+	c.Assert(code, check.Equals, http.StatusTooManyRequests)
+
+	// Server errors are counted as errors, whichever handler served them
+	s.server.instrument(func(w http.ResponseWriter, r *http.Request) {
+		setOutcome(w, outcomeFile)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	})(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	observed := map[string]uint64{}
+	ch := make(chan prometheus.Metric, 100)
+	s.server.metrics.requestDuration.Collect(ch)
+	close(ch)
+	for m := range ch {
+		pb := &dto.Metric{}
+		c.Assert(m.Write(pb), check.IsNil)
+		labels := map[string]string{}
+		for _, l := range pb.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		observed[labels["outcome"]+" "+labels["method"]] = pb.GetHistogram().GetSampleCount()
+	}
+	c.Assert(observed, check.DeepEquals, map[string]uint64{
+		"file GET":       1,
+		"file HEAD":      1,
+		"redirect GET":   5,
+		"not_found GET":  1,
+		"redirect other": 1,
+		"error GET":      2,
+		"error POST":     maxPasswordFailures + 1,
+	})
+
+	pb := &dto.Metric{}
+	c.Assert(s.server.metrics.responseBytes.WithLabelValues(outcomeFile, "GET").Write(pb), check.IsNil)
+	c.Assert(pb.GetCounter().GetValue(), check.Equals, float64(len("hello")))
+	c.Assert(s.server.metrics.responseBytes.WithLabelValues(outcomeFile, "HEAD").Write(pb), check.IsNil)
+	c.Assert(pb.GetCounter().GetValue(), check.Equals, float64(0))
+}
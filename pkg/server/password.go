@@ -0,0 +1,187 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jnsgruk/gosherve/pkg/logging"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordTemplateFile is the name of the password form template, which may be
+// overridden by a file of the same name in the webroot
+const passwordTemplateFile = "password.html"
+
+// passwordCookieMaxAge is how long a client may follow a password protected redirect
+// without being prompted for the password again.
+const passwordCookieMaxAge = time.Hour
+
+// After maxPasswordFailures incorrect passwords for an alias within passwordFailureWindow,
+// further attempts are refused until the window ends.
+const (
+	maxPasswordFailures   = 5
+	passwordFailureWindow = time.Minute
+)
+
+// maxPasswordFormSize limits the size of a submitted password form, in bytes
+const maxPasswordFormSize = 4096
+
+// passwordData is passed to the password form template
+type passwordData struct {
+	Alias       string
+	Description string
+	Error       string
+}
+
+// validatePasswordHash checks that a password hash is a valid bcrypt hash.
+func validatePasswordHash(hash string) error {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("password must be a bcrypt hash")
+	}
+	return nil
+}
+
+// passwordThrottle counts incorrect passwords for each alias, so that brute force
+// attempts can be refused.
+type passwordThrottle struct {
+	mu       sync.Mutex
+	failures map[string]*failureWindow
+}
+
+// failureWindow is the number of failed attempts since a point in time
+type failureWindow struct {
+	start time.Time
+	count int
+}
+
+func newPasswordThrottle() *passwordThrottle {
+	return &passwordThrottle{failures: map[string]*failureWindow{}}
+}
+
+// retryAfter returns how long until another attempt is allowed for an alias, or zero
+// if one is allowed now.
+func (t *passwordThrottle) retryAfter(alias string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.failures[alias]
+	if !ok {
+		return 0
+	}
+	end := f.start.Add(passwordFailureWindow)
+	if !now.Before(end) {
+		delete(t.failures, alias)
+		return 0
+	}
+	if f.count < maxPasswordFailures {
+		return 0
+	}
+	return end.Sub(now)
+}
+
+// fail records an incorrect password for an alias.
+func (t *passwordThrottle) fail(alias string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.failures[alias]
+	if !ok || !now.Before(f.start.Add(passwordFailureWindow)) {
+		f = &failureWindow{start: now}
+		t.failures[alias] = f
+	}
+	f.count++
+}
+
+// passwordCookieName returns the name of the cookie which grants access to a redirect.
+func passwordCookieName(alias string) string {
+	// Aliases may contain characters which are not valid in cookie names
+	sum := sha256.Sum256([]byte(alias))
+	return fmt.Sprintf("gosherve-auth-%x", sum[:4])
+}
+
+// signPasswordCookie returns the signature for a cookie granting access to a redirect
+// until the specified unix time. The password hash is included so that changing the
+// password revokes existing cookies.
+func (s *Server) signPasswordCookie(rd *Redirect, expiry int64) string {
+	mac := hmac.New(sha256.New, s.cookieKey)
+	fmt.Fprintf(mac, "%s\x00%s\x00%d", rd.Alias, rd.PasswordHash, expiry)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validPasswordCookie reports whether the request carries an unexpired cookie
+// granting access to a redirect.
+func (s *Server) validPasswordCookie(r *http.Request, rd *Redirect) bool {
+	c, err := r.Cookie(passwordCookieName(rd.Alias))
+	if err != nil {
+		return false
+	}
+
+	exp, sig, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return false
+	}
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || s.now().Unix() >= expiry {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.signPasswordCookie(rd, expiry)))
+}
+
+// checkPassword reports whether a request may follow a password protected redirect,
+// either because it carries a valid cookie, or submits the correct password, in which
+// case a cookie is set. Otherwise the password form is rendered, and false is returned.
+func checkPassword(w http.ResponseWriter, r *http.Request, s *Server, rd *Redirect) bool {
+	l := logging.GetLoggerFromCtx(r.Context())
+
+	if s.validPasswordCookie(r, rd) {
+		return true
+	}
+
+	data := passwordData{Alias: rd.Alias, Description: rd.Description}
+
+	if r.Method != http.MethodPost {
+		setOutcome(w, outcomeRedirect)
+		renderTemplate(w, r, s, http.StatusOK, passwordTemplateFile, data)
+		return false
+	}
+
+	now := s.now()
+	if wait := s.passwordFailures.retryAfter(rd.Alias, now); wait > 0 {
+		l.Warn("password attempts throttled", slog.Group("response", "status_code", http.StatusTooManyRequests, "alias", rd.Alias))
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+		data.Error = "Too many incorrect attempts, please try again later."
+		renderTemplate(w, r, s, http.StatusTooManyRequests, passwordTemplateFile, data)
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasswordFormSize)
+	password := r.PostFormValue("password")
+
+	if bcrypt.CompareHashAndPassword([]byte(rd.PasswordHash), []byte(password)) != nil {
+		s.passwordFailures.fail(rd.Alias, now)
+		l.Warn("incorrect password", slog.Group("response", "status_code", http.StatusForbidden, "alias", rd.Alias))
+		data.Error = "Incorrect password."
+		renderTemplate(w, r, s, http.StatusForbidden, passwordTemplateFile, data)
+		return false
+	}
+
+	expiry := now.Add(passwordCookieMaxAge).Unix()
+	http.SetCookie(w, &http.Cookie{
+		Name:     passwordCookieName(rd.Alias),
+		Value:    fmt.Sprintf("%d.%s", expiry, s.signPasswordCookie(rd, expiry)),
+		Path:     "/" + rd.Alias,
+		MaxAge:   int(passwordCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return true
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/check.v1"
+)
+
+type PasswordTestSuite struct {
+	server *Server
+	now    time.Time
+}
+
+func (s *PasswordTestSuite) SetUpTest(c *check.C) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	c.Assert(err, check.IsNil)
+
+	store := NewMemoryStore()
+	store.Put(&Redirect{Alias: "secret", URL: "http://secret.bar", PasswordHash: string(hash)})
+
+	s.now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.server = NewServerWithSource(nil, store)
+	s.server.now = func() time.Time { return s.now }
+	s.server.RefreshRedirects()
+}
+
+var _ = check.Suite(&PasswordTestSuite{})
+
+// submitPassword posts a password to the form for an alias, returning the recorded response
+func submitPassword(s *Server, alias string, password string) *httptest.ResponseRecorder {
+	form := url.Values{"password": {password}}
+	req := httptest.NewRequest("POST", "/"+alias, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	s.routeHandler(rr, req)
+	return rr
+}
+
+// requestWithCookies makes a GET request for an alias carrying the specified cookies
+func requestWithCookies(s *Server, alias string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/"+alias, nil)
+	for _, ck := range cookies {
+		req.AddCookie(ck)
+	}
+	rr := httptest.NewRecorder()
+	s.routeHandler(rr, req)
+	return rr
+}
+
+// TestPasswordForm tests that a password form is rendered instead of redirecting
+func (s *PasswordTestSuite) TestPasswordForm(c *check.C) {
+	body, code := requestRoute(s.server, "/secret")
+
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Matches, `(?s).*<form method="post">.*`)
+	c.Assert(body, check.Not(check.Matches), `(?s).*secret\.bar.*`)
+	c.Assert(s.server.hitCounts()["secret"], check.Equals, uint64(0))
+}
+
+// TestPasswordCorrect tests that the correct password redirects and sets a cookie which
+// allows subsequent visits without the password
+func (s *PasswordTestSuite) TestPasswordCorrect(c *check.C) {
+	rr := submitPassword(s.server, "secret", "hunter2")
+
+	c.Assert(rr.Code, check.Equals, http.StatusSeeOther)
+	c.Assert(rr.Header().Get("Location"), check.Equals, "http://secret.bar")
+	c.Assert(rr.Result().Cookies(), check.HasLen, 1)
+
+	cookie := rr.Result().Cookies()[0]
+	c.Assert(cookie.Path, check.Equals, "/secret")
+	c.Assert(cookie.HttpOnly, check.Equals, true)
+
+	rr = requestWithCookies(s.server, "secret", []*http.Cookie{cookie})
+	c.Assert(rr.Code, check.Equals, http.StatusFound)
+	c.Assert(rr.Header().Get("Location"), check.Equals, "http://secret.bar")
+	c.Assert(s.server.hitCounts()["secret"], check.Equals, uint64(2))
+
+	// The cookie is only valid until it expires
+	s.now = s.now.Add(passwordCookieMaxAge)
+	rr = requestWithCookies(s.server, "secret", []*http.Cookie{cookie})
+	c.Assert(rr.Code, check.Equals, http.StatusOK)
+}
+
+// TestPasswordIncorrect tests that an incorrect password re-renders the form with an error
+func (s *PasswordTestSuite) TestPasswordIncorrect(c *check.C) {
+	rr := submitPassword(s.server, "secret", "password")
+
+	c.Assert(rr.Code, check.Equals, http.StatusForbidden)
+	c.Assert(rr.Header().Get("Location"), check.Equals, "")
+	c.Assert(rr.Body.String(), check.Matches, `(?s).*Incorrect password.*`)
+	c.Assert(rr.Result().Cookies(), check.HasLen, 0)
+}
+
+// TestPasswordCookieTampered tests that forged or modified cookies are rejected
+func (s *PasswordTestSuite) TestPasswordCookieTampered(c *check.C) {
+	cookie := submitPassword(s.server, "secret", "hunter2").Result().Cookies()[0]
+
+	exp, sig, _ := strings.Cut(cookie.Value, ".")
+	forged := []string{
+		"",
+		"garbage",
+		"9999999999." + sig,
+		exp + "." + strings.Repeat("0", len(sig)),
+	}
+
+	for _, v := range forged {
+		rr := requestWithCookies(s.server, "secret", []*http.Cookie{{Name: cookie.Name, Value: v}})
+		c.Assert(rr.Code, check.Equals, http.StatusOK, check.Commentf(v))
+	}
+
+	// Changing the password revokes existing cookies
+	rd, _ := s.server.redirect("secret")
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter3"), bcrypt.MinCost)
+	s.server.setRedirect(&Redirect{Alias: "secret", URL: rd.URL, PasswordHash: string(hash)})
+	rr := requestWithCookies(s.server, "secret", []*http.Cookie{cookie})
+	c.Assert(rr.Code, check.Equals, http.StatusOK)
+}
+
+// TestPasswordThrottle tests that repeated incorrect passwords for an alias are throttled
+func (s *PasswordTestSuite) TestPasswordThrottle(c *check.C) {
+	for i := 0; i < maxPasswordFailures; i++ {
+		c.Assert(submitPassword(s.server, "secret", "wrong").Code, check.Equals, http.StatusForbidden)
+	}
+
+	// Even the correct password is refused until the window ends
+	s.now = s.now.Add(passwordFailureWindow / 2)
+	rr := submitPassword(s.server, "secret", "hunter2")
+	c.Assert(rr.Code, check.Equals, http.StatusTooManyRequests)
+	c.Assert(rr.Header().Get("Retry-After"), check.Equals, "30")
+
+	s.now = s.now.Add(passwordFailureWindow / 2)
+	c.Assert(submitPassword(s.server, "secret", "hunter2").Code, check.Equals, http.StatusSeeOther)
+}
+
+// TestPasswordPreview tests that previews do not reveal the destination of protected redirects
+func (s *PasswordTestSuite) TestPasswordPreview(c *check.C) {
+	body, code := requestRoute(s.server, "/secret+")
+
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Matches, `(?s).*password protected.*`)
+	c.Assert(body, check.Not(check.Matches), `(?s).*secret\.bar.*`)
+}
+
+// TestPasswordHashValidation tests that password hashes must be bcrypt hashes
+func (s *PasswordTestSuite) TestPasswordHashValidation(c *check.C) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+
+	redirects := parseRedirects("a http://a.com password=" + string(hash) + "\nb http://b.com password=hunter2\n")
+
+	c.Assert(redirects, check.HasLen, 1)
+	c.Assert(redirects["a"].PasswordHash, check.Equals, string(hash))
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/jnsgruk/gosherve/pkg/logging"
+)
+
+// previewSuffix is appended to an alias to request a preview rather than a redirect
+const previewSuffix = "+"
+
+// previewTemplateFile is the name of the preview template, which may be overridden by
+// a file of the same name in the webroot
+const previewTemplateFile = "preview.html"
+
+// previewData is passed to the preview template
+type previewData struct {
+	*Redirect
+	Destination string
+	Hits        uint64
+	Protected   bool
+	Limited     bool
+}
+
+// handlePreview renders a page describing a redirect when its alias is requested with a
+// "+" suffix, rather than redirecting. Unknown aliases never cause the redirects to be
+// refreshed, so previews cannot be used to trigger fetches from the source.
+func handlePreview(w http.ResponseWriter, r *http.Request, s *Server) bool {
+	path := strings.Trim(r.URL.Path, "/")
+	alias, ok := strings.CutSuffix(path, previewSuffix)
+	if !ok || alias == "" {
+		return false
+	}
+
+	// An alias which itself ends in the suffix is redirected as normal
+	if _, exists := s.redirect(path); exists {
+		return false
+	}
+
+	rd, err := s.activeRedirect(alias)
+	if errors.Is(err, ErrRedirectExpired) {
+		handleGone(w, r, s)
+		return true
+	} else if err != nil {
+		handleNotFound(w, r, s)
+		return true
+	}
+
+	renderPreview(w, r, s, rd)
+	return true
+}
+
+// renderPreview renders the preview page of a redirect.
+func renderPreview(w http.ResponseWriter, r *http.Request, s *Server, rd *Redirect) {
+	l := logging.GetLoggerFromCtx(r.Context())
+	alias := rd.Alias
+
+	data := previewData{Redirect: rd, Destination: rd.Destination(s.now()), Hits: s.hitCounts()[alias]}
+
+	// The destinations of password protected and limited-use redirects must not be revealed
+	if rd.PasswordHash != "" || rd.MaxClicks > 0 {
+		data = previewData{
+			Redirect:  &Redirect{Alias: rd.Alias, Description: rd.Description},
+			Hits:      data.Hits,
+			Protected: rd.PasswordHash != "",
+			Limited:   rd.MaxClicks > 0,
+		}
+	}
+
+	setOutcome(w, outcomeRedirect)
+	if renderTemplate(w, r, s, http.StatusOK, previewTemplateFile, data) {
+		l.Info("served preview", slog.Group("response", "status_code", http.StatusOK, "alias", alias))
+	}
+}
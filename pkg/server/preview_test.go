@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+type PreviewTestSuite struct {
+	server  *Server
+	fetches int
+}
+
+// countingSource is a RedirectSource which counts the number of times it is fetched
+type countingSource struct {
+	RedirectSource
+	fetches *int
+}
+
+func (c countingSource) Redirects() (map[string]*Redirect, error) {
+	*c.fetches++
+	return c.RedirectSource.Redirects()
+}
+
+func (s *PreviewTestSuite) SetUpTest(c *check.C) {
+	store := NewMemoryStore()
+	store.Put(&Redirect{Alias: "foo", URL: "http://foo.bar", Description: "The <foo> site"})
+	store.Put(&Redirect{Alias: "c++", URL: "http://isocpp.org"})
+
+	s.fetches = 0
+	s.server = NewServerWithSource(nil, countingSource{store, &s.fetches})
+	s.server.RefreshRedirects()
+}
+
+var _ = check.Suite(&PreviewTestSuite{})
+
+// TestPreview tests that a preview page is rendered for an alias with a "+" suffix,
+// showing the destination, escaped description and hit count
+func (s *PreviewTestSuite) TestPreview(c *check.C) {
+	requestRoute(s.server, "/foo")
+
+	body, code := requestRoute(s.server, "/foo+")
+
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Matches, `(?s).*<a href="http://foo.bar" rel="noreferrer">http://foo.bar</a>.*`)
+	c.Assert(body, check.Matches, `(?s).*<p>The &lt;foo&gt; site</p>.*`)
+	c.Assert(body, check.Matches, `(?s).*<dt>Visits</dt>\s*<dd>1</dd>.*`)
+	c.Assert(s.server.hitCounts()["foo"], check.Equals, uint64(1))
+}
+
+// TestPreviewUnknownAlias tests that previewing an unknown alias returns a 404
+// without refreshing the redirects
+func (s *PreviewTestSuite) TestPreviewUnknownAlias(c *check.C) {
+	fetches := s.fetches
+
+	body, code := requestRoute(s.server, "/unknown+")
+
+	c.Assert(code, check.Equals, http.StatusNotFound)
+	c.Assert(strings.TrimSpace(body), check.Equals, "Not found")
+	c.Assert(s.fetches, check.Equals, fetches)
+}
+
+// TestPreviewAliasWithSuffix tests that an alias which itself ends in "+" is redirected
+func (s *PreviewTestSuite) TestPreviewAliasWithSuffix(c *check.C) {
+	_, code := requestRoute(s.server, "/c++")
+	c.Assert(code, check.Equals, http.StatusMovedPermanently)
+
+	body, code := requestRoute(s.server, "/c+++")
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Matches, `(?s).*http://isocpp.org.*`)
+}
+
+// TestPreviewLimited tests that the destination of a limited-use redirect is not revealed
+func (s *PreviewTestSuite) TestPreviewLimited(c *check.C) {
+	s.server.setRedirect(&Redirect{Alias: "invite", URL: "http://invite.bar", MaxClicks: 1})
+
+	body, code := requestRoute(s.server, "/invite+")
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Matches, `(?s).*limited number of times.*`)
+	c.Assert(body, check.Not(check.Matches), `(?s).*invite\.bar.*`)
+}
+
+// TestPreviewNonWebDestination tests that only http and https destinations are linked
+func (s *PreviewTestSuite) TestPreviewNonWebDestination(c *check.C) {
+	s.server.setRedirect(&Redirect{Alias: "js", URL: "javascript:alert(1)", Devices: map[string]string{"ios": "/app"}})
+
+	body, code := requestRoute(s.server, "/js+")
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Matches, `(?s).*<dd>javascript:alert\(1\)</dd>.*`)
+	c.Assert(body, check.Matches, `(?s).*<dd>/app</dd>.*`)
+	c.Assert(body, check.Not(check.Matches), `(?s).*<a href.*`)
+}
+
+// TestPreviewTemplateOverride tests that a preview.html in the webroot is used as the template
+func (s *PreviewTestSuite) TestPreviewTemplateOverride(c *check.C) {
+	dir := c.MkDir()
+	os.WriteFile(path.Join(dir, "preview.html"), []byte(`{{ .Alias }} goes to {{ .Destination }}`), 0666)
+	fsys := os.DirFS(dir)
+	s.server.webroot = &fsys
+
+	body, code := requestRoute(s.server, "/foo+")
+
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Equals, "foo goes to http://foo.bar")
+
+	os.WriteFile(path.Join(dir, "preview.html"), []byte(`{{ .Broken`), 0666)
+	_, code = requestRoute(s.server, "/foo+")
+	c.Assert(code, check.Equals, http.StatusInternalServerError)
+}
+
+// TestParseDescription tests that URL encoded descriptions are parsed
+func (s *PreviewTestSuite) TestParseDescription(c *check.C) {
+	redirects := parseRedirects("cal http://cal.com description=Team+calendar%21\n")
+	c.Assert(redirects["cal"].Description, check.Equals, "Team calendar!")
+}
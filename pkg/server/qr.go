@@ -0,0 +1,260 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jnsgruk/gosherve/pkg/logging"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// qrPrefix is the path prefix under which QR codes for aliases are served
+const qrPrefix = "/-/qr/"
+
+// Limits and defaults for the size of generated QR codes, in pixels
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+)
+
+// maxQRCacheEntries bounds the number of generated QR codes held in memory, beyond
+// which the least recently used are evicted
+const maxQRCacheEntries = 1024
+
+// qrLevels maps the standard error correction level names to their implementation
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// qrKey identifies a generated QR code in the cache
+type qrKey struct {
+	alias  string
+	url    string
+	format string
+	level  string
+	size   int
+}
+
+// qrEntry is a QR code held in the cache
+type qrEntry struct {
+	key  qrKey
+	code []byte
+}
+
+// qrCache holds generated QR codes for the aliases which are defined, evicting the
+// least recently used once it is full. The codes only encode short links, so they
+// remain valid when the destinations of the redirects change.
+type qrCache struct {
+	mu      sync.Mutex
+	entries map[qrKey]*list.Element
+	order   *list.List
+}
+
+func newQRCache() *qrCache {
+	return &qrCache{entries: map[qrKey]*list.Element{}, order: list.New()}
+}
+
+// get returns a cached QR code, generating and caching it if necessary.
+func (c *qrCache) get(key qrKey, generate func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*qrEntry).code, nil
+	}
+	c.mu.Unlock()
+
+	code, err := generate()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&qrEntry{key: key, code: code})
+		if c.order.Len() > maxQRCacheEntries {
+			c.remove(c.order.Back())
+		}
+	}
+	return code, nil
+}
+
+// removeAliases removes the cached QR codes of aliases for which keep returns false.
+func (c *qrCache) removeAliases(keep func(alias string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.entries {
+		if !keep(key.alias) {
+			c.remove(el)
+		}
+	}
+}
+
+// remove removes an entry from the cache, and must be called with mu held.
+func (c *qrCache) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*qrEntry).key)
+	c.order.Remove(el)
+}
+
+// ConfigureBaseURL sets the URL at which gosherve is publicly served, which is used
+// when encoding short links in QR codes. If unset, it is derived from each request.
+func (s *Server) ConfigureBaseURL(base string) error {
+	if base == "" {
+		s.baseURL = ""
+		return nil
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("base url must be an absolute http or https url: %s", base)
+	}
+	s.baseURL = strings.TrimSuffix(base, "/")
+	return nil
+}
+
+// shortURL returns the full short link for an alias.
+func (s *Server) shortURL(r *http.Request, alias string) string {
+	base := s.baseURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		base = fmt.Sprintf("%s://%s", scheme, r.Host)
+	}
+	return base + "/" + (&url.URL{Path: alias}).EscapedPath()
+}
+
+// handleQR serves a QR code encoding the short link for an alias. The format, size
+// and error correction level can be chosen with the "format" (png or svg), "size"
+// and "level" (L, M, Q or H) query parameters.
+func handleQR(w http.ResponseWriter, r *http.Request, s *Server) bool {
+	l := logging.GetLoggerFromCtx(r.Context())
+
+	alias, ok := strings.CutPrefix(r.URL.Path, qrPrefix)
+	alias = strings.Trim(alias, "/")
+	if !ok || alias == "" {
+		return false
+	}
+
+	key, err := parseQRKey(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.metrics.responseStatus.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		return true
+	}
+
+	_, err = s.lookupRedirect(alias)
+	if errors.Is(err, ErrRedirectExpired) {
+		handleGone(w, r, s)
+		return true
+	} else if err != nil {
+		handleNotFound(w, r, s)
+		return true
+	}
+
+	key.alias = alias
+	key.url = s.shortURL(r, alias)
+
+	code, err := s.qrCode(key)
+	if err != nil {
+		l.Error("failed to generate qr code", "error", err.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		s.metrics.responseStatus.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		return true
+	}
+
+	contentType := "image/png"
+	if key.format == "svg" {
+		contentType = "image/svg+xml"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	setOutcome(w, outcomeRedirect)
+	w.Write(code)
+
+	s.metrics.responseStatus.WithLabelValues(strconv.Itoa(http.StatusOK)).Inc()
+	l.Info("served qr code", slog.Group("response", "status_code", http.StatusOK, "alias", alias, "url", key.url))
+
+	return true
+}
+
+// qrCode returns the QR code described by the key. Codes are only cached if the base
+// URL is configured, since otherwise the short link encoded in each code is derived from
+// the Host header of the request, and any number of hosts could fill the cache.
+func (s *Server) qrCode(key qrKey) ([]byte, error) {
+	generate := func() ([]byte, error) { return generateQR(key) }
+	if s.baseURL == "" {
+		return generate()
+	}
+	return s.qrCodes.get(key, generate)
+}
+
+// parseQRKey parses the QR code options from a request's query parameters.
+func parseQRKey(query url.Values) (qrKey, error) {
+	key := qrKey{format: "png", level: "M", size: defaultQRSize}
+
+	if f := query.Get("format"); f != "" {
+		if f != "png" && f != "svg" {
+			return qrKey{}, fmt.Errorf("invalid format '%s', must be png or svg", f)
+		}
+		key.format = f
+	}
+
+	if lvl := strings.ToUpper(query.Get("level")); lvl != "" {
+		if _, ok := qrLevels[lvl]; !ok {
+			return qrKey{}, fmt.Errorf("invalid error correction level '%s', must be L, M, Q or H", lvl)
+		}
+		key.level = lvl
+	}
+
+	if sz := query.Get("size"); sz != "" {
+		size, err := strconv.Atoi(sz)
+		if err != nil || size < minQRSize || size > maxQRSize {
+			return qrKey{}, fmt.Errorf("invalid size '%s', must be between %d and %d", sz, minQRSize, maxQRSize)
+		}
+		key.size = size
+	}
+
+	return key, nil
+}
+
+// generateQR renders a QR code in the format described by the key.
+func generateQR(key qrKey) ([]byte, error) {
+	qr, err := qrcode.New(key.url, qrLevels[key.level])
+	if err != nil {
+		return nil, err
+	}
+
+	if key.format == "png" {
+		return qr.PNG(key.size)
+	}
+
+	// Draw each dark module as a unit square, scaled to the requested size by the viewBox
+	bitmap := qr.Bitmap()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		key.size, key.size, len(bitmap), len(bitmap))
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="`)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type QRTestSuite struct {
+	server *Server
+	store  *MemoryStore
+}
+
+func (s *QRTestSuite) SetUpTest(c *check.C) {
+	s.store = NewMemoryStore()
+	s.store.Put(&Redirect{Alias: "foo", URL: "http://foo.bar"})
+	s.server = NewServerWithSource(nil, s.store)
+	s.server.RefreshRedirects()
+}
+
+var _ = check.Suite(&QRTestSuite{})
+
+// requestQR requests a QR code from the server, returning the recorded response
+func requestQR(s *Server, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	rr := httptest.NewRecorder()
+	s.routeHandler(rr, req)
+	return rr
+}
+
+// TestQRPNG tests that a PNG of the requested size is served by default
+func (s *QRTestSuite) TestQRPNG(c *check.C) {
+	rr := requestQR(s.server, "/-/qr/foo?size=300")
+
+	c.Assert(rr.Code, check.Equals, http.StatusOK)
+	c.Assert(rr.Header().Get("Content-Type"), check.Equals, "image/png")
+
+	img, err := png.Decode(rr.Body)
+	c.Assert(err, check.IsNil)
+	c.Assert(img.Bounds().Dx(), check.Equals, 300)
+	c.Assert(img.Bounds().Dy(), check.Equals, 300)
+}
+
+// TestQRSVG tests that an SVG is served when requested
+func (s *QRTestSuite) TestQRSVG(c *check.C) {
+	rr := requestQR(s.server, "/-/qr/foo?format=svg&level=h")
+
+	c.Assert(rr.Code, check.Equals, http.StatusOK)
+	c.Assert(rr.Header().Get("Content-Type"), check.Equals, "image/svg+xml")
+	c.Assert(strings.HasPrefix(rr.Body.String(), "<svg "), check.Equals, true)
+	c.Assert(rr.Body.String(), check.Matches, `.*width="256" height="256".*`)
+}
+
+// TestQRInvalidOptions tests that invalid query parameters are rejected
+func (s *QRTestSuite) TestQRInvalidOptions(c *check.C) {
+	for _, q := range []string{"format=gif", "level=X", "size=10", "size=big"} {
+		rr := requestQR(s.server, "/-/qr/foo?"+q)
+		c.Assert(rr.Code, check.Equals, http.StatusBadRequest, check.Commentf(q))
+	}
+}
+
+// TestQRUnknownAlias tests that QR codes are only served for defined, active redirects
+func (s *QRTestSuite) TestQRUnknownAlias(c *check.C) {
+	c.Assert(requestQR(s.server, "/-/qr/unknown").Code, check.Equals, http.StatusNotFound)
+
+	expired := time.Now().Add(-time.Hour)
+	s.store.Put(&Redirect{Alias: "old", URL: "http://old.bar", NotAfter: &expired})
+	s.server.RefreshRedirects()
+	c.Assert(requestQR(s.server, "/-/qr/old").Code, check.Equals, http.StatusGone)
+}
+
+// TestQRShortURL tests that the short URL is derived from the request unless a base
+// URL is configured
+func (s *QRTestSuite) TestQRShortURL(c *check.C) {
+	req := httptest.NewRequest("GET", "/-/qr/foo", nil)
+	req.Host = "go.example.com"
+	c.Assert(s.server.shortURL(req, "a b"), check.Equals, "http://go.example.com/a%20b")
+
+	req.Header.Set("X-Forwarded-Proto", "https")
+	c.Assert(s.server.shortURL(req, "foo"), check.Equals, "https://go.example.com/foo")
+
+	c.Assert(s.server.ConfigureBaseURL("https://jnsgr.uk/"), check.IsNil)
+	c.Assert(s.server.shortURL(req, "foo"), check.Equals, "https://jnsgr.uk/foo")
+
+	c.Assert(s.server.ConfigureBaseURL("jnsgr.uk"), check.NotNil)
+}
+
+// TestQRCache tests that generated QR codes are cached when the base URL is configured,
+// and kept until their alias is removed
+func (s *QRTestSuite) TestQRCache(c *check.C) {
+	// Codes for short links derived from the Host header are not cached
+	first := requestQR(s.server, "/-/qr/foo").Body.Bytes()
+	c.Assert(s.server.qrCodes.entries, check.HasLen, 0)
+
+	c.Assert(s.server.ConfigureBaseURL("http://example.com"), check.IsNil)
+	c.Assert(bytes.Equal(requestQR(s.server, "/-/qr/foo").Body.Bytes(), first), check.Equals, true)
+	c.Assert(s.server.qrCodes.entries, check.HasLen, 1)
+
+	// Poison the cache to check that it is used
+	for _, el := range s.server.qrCodes.entries {
+		el.Value.(*qrEntry).code = []byte("cached")
+	}
+	c.Assert(requestQR(s.server, "/-/qr/foo").Body.String(), check.Equals, "cached")
+
+	// Changing the destination, or a refresh triggered by an unknown alias, keeps the code
+	s.server.setRedirect(&Redirect{Alias: "foo", URL: "http://foo.baz"})
+	c.Assert(requestQR(s.server, "/-/qr/unknown").Code, check.Equals, http.StatusNotFound)
+	c.Assert(requestQR(s.server, "/-/qr/foo").Body.String(), check.Equals, "cached")
+
+	s.server.deleteRedirect("foo")
+	c.Assert(s.server.qrCodes.entries, check.HasLen, 0)
+}
+
+// TestQRCacheEviction tests that the least recently used QR codes are evicted once the
+// cache is full
+func (s *QRTestSuite) TestQRCacheEviction(c *check.C) {
+	cache := newQRCache()
+	generate := func() ([]byte, error) { return []byte("code"), nil }
+	key := func(size int) qrKey { return qrKey{alias: "foo", size: size} }
+
+	for i := 0; i < maxQRCacheEntries; i++ {
+		cache.get(key(i), generate)
+	}
+	cache.get(key(0), generate)
+	cache.get(key(maxQRCacheEntries), generate)
+
+	c.Assert(cache.entries, check.HasLen, maxQRCacheEntries)
+	c.Assert(cache.entries[key(0)], check.NotNil)
+	c.Assert(cache.entries[key(1)], check.IsNil)
+	c.Assert(cache.entries[key(maxQRCacheEntries)], check.NotNil)
+}
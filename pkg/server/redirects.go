@@ -1,97 +1,522 @@
 package server
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
-	"net/http"
+	"maps"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
 
+var (
+	// ErrRedirectNotFound is returned when a requested alias is not defined.
+	ErrRedirectNotFound = errors.New("redirect not found")
+	// ErrRedirectExpired is returned when a requested alias was defined, but has expired.
+	ErrRedirectExpired = errors.New("redirect expired")
+)
+
+// Redirect is a single alias/URL pair served by gosherve.
+type Redirect struct {
+	Alias string `json:"alias"`
+	URL   string `json:"url"`
+	// Description is an optional human readable description of the redirect
+	Description string `json:"description,omitempty"`
+	// NotBefore and NotAfter optionally bound the time during which the redirect
+	// is served. A redirect is active from NotBefore, and expires at NotAfter.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	// Schedule optionally lists future destinations for the redirect, ordered by
+	// the time at which they take effect. Until the first takes effect, URL is used.
+	Schedule []ScheduledURL `json:"schedule,omitempty"`
+	// Variants optionally split traffic between several weighted destinations,
+	// which take precedence over URL. If Sticky is set, clients are sent to the
+	// same variant on subsequent visits.
+	Variants []Variant `json:"variants,omitempty"`
+	Sticky   bool      `json:"sticky,omitempty"`
+	// Devices optionally maps device classes (ios, android, desktop, bot) to
+	// destinations, which take precedence over all others for matching clients.
+	Devices map[string]string `json:"devices,omitempty"`
+	// Languages optionally maps BCP 47 language tags to destinations, which are
+	// chosen by negotiation with the Accept-Language header of the request.
+	Languages map[string]string `json:"languages,omitempty"`
+	// PasswordHash is an optional bcrypt hash of a password which must be entered
+	// before the redirect is followed.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxClicks optionally limits the number of times the redirect can be followed,
+	// after which it expires. Clicks is the number of times it has been followed.
+	MaxClicks int `json:"max_clicks,omitempty"`
+	Clicks    int `json:"clicks,omitempty"`
+	// Hidden excludes the redirect from the public link directory, and Tags are used
+	// to group and filter redirects in the directory.
+	Hidden bool     `json:"hidden,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// ScheduledURL is a destination which a redirect switches to at a given time.
+type ScheduledURL struct {
+	At  time.Time `json:"at"`
+	URL string    `json:"url"`
+}
+
+// Destination returns the URL that the redirect points to at the specified time,
+// taking into account any scheduled changes.
+func (r *Redirect) Destination(now time.Time) string {
+	url := r.URL
+	for _, s := range r.Schedule {
+		if now.Before(s.At) {
+			break
+		}
+		url = s.URL
+	}
+	return url
+}
+
+// Dynamic reports whether the destination of a redirect may change over time or
+// between requests, in which case it must not be cached by clients.
+func (r *Redirect) Dynamic() bool {
+	return r.NotAfter != nil || len(r.Schedule) > 0 || len(r.Variants) > 0 || len(r.Devices) > 0 ||
+		len(r.Languages) > 0 || r.PasswordHash != "" || r.MaxClicks > 0
+}
+
+// NextChange returns the next scheduled change of destination after the specified
+// time, or nil if there is none.
+func (r *Redirect) NextChange(now time.Time) *ScheduledURL {
+	for _, s := range r.Schedule {
+		if now.Before(s.At) {
+			return &s
+		}
+	}
+	return nil
+}
+
+// Validate checks that a redirect conforms to the same rules that are applied
+// when parsing a redirects file.
+func (r *Redirect) Validate() error {
+	if r.Alias == "" {
+		return fmt.Errorf("alias must not be empty")
+	}
+	if strings.Contains(r.Alias, " ") {
+		return fmt.Errorf("alias must not contain spaces")
+	}
+	if r.Alias == otherAlias {
+		return fmt.Errorf("alias '%s' is reserved", otherAlias)
+	}
+	if err := validateURL(r.URL); err != nil {
+		return err
+	}
+	for i, s := range r.Schedule {
+		if err := validateURL(s.URL); err != nil {
+			return fmt.Errorf("schedule: %w", err)
+		}
+		if i > 0 && !s.At.After(r.Schedule[i-1].At) {
+			return fmt.Errorf("schedule must be ordered by time")
+		}
+	}
+	if err := validateVariants(r.Variants); err != nil {
+		return err
+	}
+	if err := validateLanguages(r.Languages); err != nil {
+		return err
+	}
+	for device, u := range r.Devices {
+		if !slices.Contains(deviceClasses, device) {
+			return fmt.Errorf("unknown device class '%s'", device)
+		}
+		if err := validateURL(u); err != nil {
+			return fmt.Errorf("device '%s': %w", device, err)
+		}
+	}
+	if err := validateTags(r.Tags); err != nil {
+		return err
+	}
+	if r.MaxClicks < 0 || r.Clicks < 0 {
+		return fmt.Errorf("max_clicks and clicks must not be negative")
+	}
+	if r.PasswordHash != "" {
+		if err := validatePasswordHash(r.PasswordHash); err != nil {
+			return err
+		}
+	}
+	if r.NotBefore != nil && r.NotAfter != nil && !r.NotAfter.After(*r.NotBefore) {
+		return fmt.Errorf("not_after must be later than not_before")
+	}
+	return nil
+}
+
+// validateURL checks that a redirect destination is a valid URL.
+func validateURL(u string) error {
+	if u == "" {
+		return fmt.Errorf("url must not be empty")
+	}
+	if strings.Contains(u, " ") {
+		return fmt.Errorf("url must not contain spaces")
+	}
+	if _, err := url.Parse(u); err != nil {
+		return fmt.Errorf("invalid url: %s", u)
+	}
+	return nil
+}
+
+// isWebURL reports whether a destination is an http or https URL. Only these are
+// rendered as links, since other schemes, such as javascript:, could run in the page.
+func isWebURL(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https")
+}
+
+// destinations returns every destination of the redirect.
+func (r *Redirect) destinations() []string {
+	urls := []string{r.URL}
+	for _, s := range r.Schedule {
+		urls = append(urls, s.URL)
+	}
+	for _, v := range r.Variants {
+		urls = append(urls, v.URL)
+	}
+	for _, u := range r.Devices {
+		urls = append(urls, u)
+	}
+	for _, u := range r.Languages {
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// parseAttributes sets the optional fields of a redirect from a list of
+// key=value attributes, as specified after the URL in a redirects file.
+func (r *Redirect) parseAttributes(attrs []string) error {
+	for _, attr := range attrs {
+		key, value, ok := strings.Cut(attr, "=")
+		if !ok {
+			return fmt.Errorf("invalid attribute '%s'", attr)
+		}
+
+		switch key {
+		case "description":
+			// Descriptions are URL encoded, so that they may contain spaces
+			description, err := url.QueryUnescape(value)
+			if err != nil {
+				return fmt.Errorf("invalid description: %s", value)
+			}
+			r.Description = description
+		case "not_before", "not_after":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fmt.Errorf("invalid time for %s: %s", key, value)
+			}
+			if key == "not_before" {
+				r.NotBefore = &t
+			} else {
+				r.NotAfter = &t
+			}
+		case "schedule":
+			// Scheduled destinations are specified as schedule=<time>,<url>
+			at, url, ok := strings.Cut(value, ",")
+			if !ok {
+				return fmt.Errorf("invalid schedule: %s", value)
+			}
+			t, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				return fmt.Errorf("invalid time for schedule: %s", at)
+			}
+			r.Schedule = append(r.Schedule, ScheduledURL{At: t, URL: url})
+		case "variant":
+			// Variants are specified as variant=<name>,<weight>,<url>
+			v, err := parseVariant(value)
+			if err != nil {
+				return err
+			}
+			r.Variants = append(r.Variants, v)
+		case "device":
+			// Device specific destinations are specified as device=<class>,<url>
+			device, url, ok := strings.Cut(value, ",")
+			if !ok {
+				return fmt.Errorf("invalid device: %s", value)
+			}
+			if r.Devices == nil {
+				r.Devices = map[string]string{}
+			}
+			r.Devices[device] = url
+		case "lang":
+			// Language specific destinations are specified as lang=<tag>,<url>
+			tag, url, ok := strings.Cut(value, ",")
+			if !ok {
+				return fmt.Errorf("invalid lang: %s", value)
+			}
+			if r.Languages == nil {
+				r.Languages = map[string]string{}
+			}
+			r.Languages[tag] = url
+		case "max_clicks":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for max_clicks: %s", value)
+			}
+			r.MaxClicks = n
+		case "clicks":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for clicks: %s", value)
+			}
+			r.Clicks = n
+		case "password":
+			r.PasswordHash = value
+		case "hidden":
+			hidden, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for hidden: %s", value)
+			}
+			r.Hidden = hidden
+		case "tags":
+			// Tags are specified as a comma separated list
+			r.Tags = append(r.Tags, strings.Split(value, ",")...)
+		case "sticky":
+			sticky, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for sticky: %s", value)
+			}
+			r.Sticky = sticky
+		default:
+			return fmt.Errorf("unknown attribute '%s'", key)
+		}
+	}
+
+	slices.SortStableFunc(r.Schedule, func(a, b ScheduledURL) int { return a.At.Compare(b.At) })
+	return nil
+}
+
+// String returns the redirect as a line of a redirects file, including its attributes.
+func (r *Redirect) String() string {
+	parts := []string{r.Alias, r.URL}
+	attr := func(key, value string) { parts = append(parts, key+"="+value) }
+
+	if r.Description != "" {
+		attr("description", url.QueryEscape(r.Description))
+	}
+	if r.NotBefore != nil {
+		attr("not_before", r.NotBefore.Format(time.RFC3339))
+	}
+	if r.NotAfter != nil {
+		attr("not_after", r.NotAfter.Format(time.RFC3339))
+	}
+	for _, s := range r.Schedule {
+		attr("schedule", s.At.Format(time.RFC3339)+","+s.URL)
+	}
+	for _, v := range r.Variants {
+		attr("variant", fmt.Sprintf("%s,%d,%s", v.Name, v.Weight, v.URL))
+	}
+	if r.Sticky {
+		attr("sticky", "true")
+	}
+	for _, device := range slices.Sorted(maps.Keys(r.Devices)) {
+		attr("device", device+","+r.Devices[device])
+	}
+	for _, tag := range slices.Sorted(maps.Keys(r.Languages)) {
+		attr("lang", tag+","+r.Languages[tag])
+	}
+	if r.MaxClicks > 0 {
+		attr("max_clicks", strconv.Itoa(r.MaxClicks))
+	}
+	if r.Clicks > 0 {
+		attr("clicks", strconv.Itoa(r.Clicks))
+	}
+	if r.PasswordHash != "" {
+		attr("password", r.PasswordHash)
+	}
+	if r.Hidden {
+		attr("hidden", "true")
+	}
+	if len(r.Tags) > 0 {
+		attr("tags", strings.Join(r.Tags, ","))
+	}
+
+	return strings.Join(parts, " ")
+}
+
 // RefreshRedirects is used to refresh the list of configured redirects
 // in the manager by fetching the latest copy from the specified source.
 func (s *Server) RefreshRedirects() error {
-	redirects, err := s.fetchRedirects()
+	redirects, err := s.loadRedirects()
 	if err != nil {
 		slog.Error("failed to update redirect map", "error", err.Error())
 		return fmt.Errorf("error refreshing redirects")
 	}
+
+	s.mu.Lock()
 	s.redirects = redirects
+	s.mu.Unlock()
+	keep := func(alias string) bool {
+		_, ok := redirects[alias]
+		return ok
+	}
+	s.qrCodes.removeAliases(keep)
+	s.metrics.removeAliases(keep)
+
+	// Record the version of redirects from sources which have one, logging changes
+	if v, ok := s.source.(VersionedSource); ok {
+		version := v.Version()
+		s.metrics.redirectsVersion.Reset()
+		s.metrics.redirectsVersion.WithLabelValues(version).Set(1)
+
+		s.mu.Lock()
+		changed := s.version != version
+		s.version = version
+		s.mu.Unlock()
+
+		if changed {
+			slog.Info("loaded redirects", "version", version, "redirects", len(redirects))
+		}
+	}
+
 	s.metrics.redirectsDefined.Set(float64(s.NumRedirects()))
 	return nil
 }
 
 // LookupRedirect checks if an alias/redirect has been specified and returns it.
-// If not found, this method will update the list of redirects and retry the lookup.
+// If not defined, this method will update the list of redirects and retry the lookup.
+// Redirects which are not yet active are treated as not found, and those which have
+// expired return ErrRedirectExpired.
 func (s *Server) LookupRedirect(alias string) (string, error) {
-	// Lookup the redirect and return the URL if found
-	if url, exists := s.redirects[alias]; exists {
-		return url, nil
+	r, err := s.lookupRedirect(alias)
+	if err != nil {
+		return "", err
+	}
+	return r.Destination(s.now()), nil
+}
+
+// lookupRedirect returns the active redirect for an alias, refreshing the list of
+// redirects if it is not defined. Redirects which are defined, but are not yet active,
+// have expired or have no clicks remaining, do not cause a refresh, since they are
+// likely to be requested repeatedly.
+func (s *Server) lookupRedirect(alias string) (*Redirect, error) {
+	// Lookup the redirect and return it if found
+	r, err := s.activeRedirect(alias)
+	if !errors.Is(err, ErrRedirectNotFound) {
+		return r, err
+	}
+	if _, exists := s.redirect(alias); exists {
+		return nil, err
 	}
 
 	// Redirect not found, so let's update the list
-	err := s.RefreshRedirects()
-	if err != nil {
+	if refreshErr := s.RefreshRedirects(); refreshErr != nil {
 		// Return error but don't exit the program - this will leave the
 		// existing map in place which should still work fine.
-		return "", fmt.Errorf("redirect not found")
+		return nil, err
 	}
 
-	// Check again, if redirect now exists then return the URL
-	if url, exists := s.redirects[alias]; exists {
-		return url, nil
+	// Check again, if redirect now exists then return it
+	return s.activeRedirect(alias)
+}
+
+// activeRedirect returns the redirect for an alias if it is active at the current
+// time and has clicks remaining, without refreshing.
+func (s *Server) activeRedirect(alias string) (*Redirect, error) {
+	r, exists := s.redirect(alias)
+	if !exists {
+		return nil, ErrRedirectNotFound
 	}
 
-	return "", fmt.Errorf("redirect not found")
+	now := s.now()
+	if r.NotBefore != nil && now.Before(*r.NotBefore) {
+		return nil, ErrRedirectNotFound
+	}
+	if r.NotAfter != nil && !now.Before(*r.NotAfter) || s.exhausted(r) {
+		return nil, ErrRedirectExpired
+	}
+	return r, nil
 }
 
 // NumRedirects returns the number of redirects that are currently defined
 func (s *Server) NumRedirects() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return len(s.redirects)
 }
 
-// fetchRedirects gets the latest redirects from the specified url
-func (s *Server) fetchRedirects() (map[string]string, error) {
-	// Add a query param to the URL to break caching if required (Github Gists!)
-	reqURL := fmt.Sprintf("%s?cachebust=%d", s.redirectsSource, time.Now().Unix())
+// redirect returns the currently loaded redirect for an alias, without refreshing.
+func (s *Server) redirect(alias string) (*Redirect, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, exists := s.redirects[alias]
+	return r, exists
+}
 
-	resp, err := http.Get(reqURL)
-	slog.Debug("fetched redirects specification", "url", reqURL)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching redirects from %s", reqURL)
-	}
+// setRedirect adds or replaces a single redirect in the loaded map. Clicks counted in
+// memory which have not been persisted are kept, unless they are reset with resetClicks.
+func (s *Server) setRedirect(r *Redirect) {
+	s.mu.Lock()
+	s.redirects[r.Alias] = r
+	s.mu.Unlock()
+	s.metrics.redirectsDefined.Set(float64(s.NumRedirects()))
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading redirect gist")
-	}
+// deleteRedirect removes a single redirect from the loaded map.
+func (s *Server) deleteRedirect(alias string) {
+	s.mu.Lock()
+	delete(s.redirects, alias)
+	s.mu.Unlock()
+	s.resetClicks(alias)
+	keep := func(a string) bool { return a != alias }
+	s.qrCodes.removeAliases(keep)
+	s.metrics.removeAliases(keep)
+	s.metrics.redirectsDefined.Set(float64(s.NumRedirects()))
+}
 
-	redirects := make(map[string]string)
+// recordHit increments the number of times the redirect for an alias has been served.
+func (s *Server) recordHit(alias string) {
+	s.hitsMu.Lock()
+	s.hits[alias]++
+	s.hitsMu.Unlock()
+}
 
-	for i, line := range strings.Split(string(body), "\n") {
+// hitCounts returns the number of times each redirect has been served since startup.
+func (s *Server) hitCounts() map[string]uint64 {
+	s.hitsMu.Lock()
+	defer s.hitsMu.Unlock()
+	return maps.Clone(s.hits)
+}
+
+// parseRedirects parses a redirects file, which contains one alias/URL pair per
+// line separated by a single space, optionally followed by space separated
+// key=value attributes. Invalid lines are logged and skipped.
+func parseRedirects(body string) map[string]*Redirect {
+	redirects := make(map[string]*Redirect)
+
+	for i, line := range strings.Split(body, "\n") {
 		// Ignore blank lines
 		if len(line) == 0 {
 			continue
 		}
 
 		parts := strings.Split(line, " ")
-		// Reject the line if there is more than one space
-		if len(parts) != 2 {
+		// Reject the line if there is no URL
+		if len(parts) < 2 {
 			slog.Debug("invalid redirect specification", "line", i+1)
 			continue
 		}
 
+		r := &Redirect{Alias: parts[0], URL: parts[1]}
+
+		// Any further parts are attributes of the redirect
+		if err := r.parseAttributes(parts[2:]); err != nil {
+			slog.Debug("invalid redirect attributes", "line", i+1, "error", err.Error())
+			continue
+		}
+
 		// Check the second part is actually a valid URL
-		if _, err := url.Parse(parts[1]); err != nil {
-			slog.Debug("invalid url detected in redirects file", "line", i+1, "url", parts[1])
+		if err := r.Validate(); err != nil {
+			slog.Debug("invalid redirect detected in redirects file", "line", i+1, "url", parts[1], "error", err.Error())
 		} else {
 			// Naive parsing complete, add redirect to the map
-			redirects[parts[0]] = parts[1]
-			rg := slog.Group("redirect", "alias", parts[0], "url", parts[1])
+			redirects[r.Alias] = r
+			rg := slog.Group("redirect", "alias", r.Alias, "url", r.URL)
 			slog.Debug("updated redirect", rg)
 		}
 	}
-	return redirects, nil
+	return redirects
 }
@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"time"
 
 	"gopkg.in/check.v1"
 )
@@ -31,15 +32,15 @@ func (s *RedirectsTestSuite) TestFetchRedirectsOnInit(c *check.C) {
 	defer mockServer.Close()
 
 	server := NewServer(nil, fmt.Sprintf("%s/mockRedirects1", mockServer.URL))
-	c.Assert(server.redirects, check.DeepEquals, map[string]string{})
+	c.Assert(server.redirects, check.DeepEquals, map[string]*Redirect{})
 	c.Assert(readGauge(server.metrics.redirectsDefined), check.Equals, float64(0))
 
 	err := server.RefreshRedirects()
 
 	c.Assert(err, check.IsNil)
-	c.Assert(server.redirects, check.DeepEquals, map[string]string{
-		"foo": "http://foo.bar",
-		"bar": "http://bar.baz",
+	c.Assert(server.redirects, check.DeepEquals, map[string]*Redirect{
+		"foo": {Alias: "foo", URL: "http://foo.bar"},
+		"bar": {Alias: "bar", URL: "http://bar.baz"},
 	})
 	c.Assert(readGauge(server.metrics.redirectsDefined), check.Equals, float64(2))
 }
@@ -55,16 +56,16 @@ func (s *RedirectsTestSuite) TestRedirectsUpdate(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(readGauge(server.metrics.redirectsDefined), check.Equals, float64(2))
 
-	server.redirectsSource = fmt.Sprintf("%s/mockRedirects2", mockServer.URL)
+	server.source = NewURLSource(fmt.Sprintf("%s/mockRedirects2", mockServer.URL))
 	err = server.RefreshRedirects()
 
 	c.Assert(err, check.IsNil)
 	c.Assert(readGauge(server.metrics.redirectsDefined), check.Equals, float64(3))
 
-	c.Assert(server.redirects, check.DeepEquals, map[string]string{
-		"foo": "http://foo.bar",
-		"bar": "http://bar.baz",
-		"baz": "http://baz.qux",
+	c.Assert(server.redirects, check.DeepEquals, map[string]*Redirect{
+		"foo": {Alias: "foo", URL: "http://foo.bar"},
+		"bar": {Alias: "bar", URL: "http://bar.baz"},
+		"baz": {Alias: "baz", URL: "http://baz.qux"},
 	})
 }
 
@@ -89,7 +90,7 @@ func (s *RedirectsTestSuite) TestRedirectsUpdateFailedRefresh(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(readGauge(server.metrics.redirectsDefined), check.Equals, float64(2))
 
-	server.redirectsSource = "badurl"
+	server.source = NewURLSource("badurl")
 	err = server.RefreshRedirects()
 
 	c.Assert(err, check.ErrorMatches, "error refreshing redirects")
@@ -100,7 +101,7 @@ func (s *RedirectsTestSuite) TestRedirectsUpdateFailedRefresh(c *check.C) {
 // redirect is present in the map
 func (s *RedirectsTestSuite) TestLookupRedirectPresent(c *check.C) {
 	server := NewServer(nil, "test")
-	server.redirects = map[string]string{"foo": "http://foo.bar"}
+	server.redirects = map[string]*Redirect{"foo": {Alias: "foo", URL: "http://foo.bar"}}
 	redirect, err := server.LookupRedirect("foo")
 
 	c.Assert(err, check.IsNil)
@@ -136,3 +137,160 @@ func (s *RedirectsTestSuite) TestLookupRedirectFail(c *check.C) {
 	c.Assert(redirect, check.Equals, "")
 	c.Assert(err, check.ErrorMatches, "redirect not found")
 }
+
+// TestParseRedirectsAttributes tests that time bounds are parsed from redirect
+// attributes, and that lines with invalid attributes are rejected
+func (s *RedirectsTestSuite) TestParseRedirectsAttributes(c *check.C) {
+	redirects := parseRedirects(`
+promo http://promo.com not_before=2026-01-01T00:00:00Z not_after=2026-02-01T00:00:00Z
+late http://late.com not_after=2026-02-01T00:00:00+01:00
+badtime http://bad.com not_after=tomorrow
+backwards http://bad.com not_before=2026-02-01T00:00:00Z not_after=2026-01-01T00:00:00Z
+unknown http://bad.com colour=blue
+noequals http://bad.com garbage
+`)
+
+	notBefore := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	c.Assert(redirects, check.HasLen, 2)
+	c.Assert(redirects["promo"].NotBefore.Equal(notBefore), check.Equals, true)
+	c.Assert(redirects["promo"].NotAfter.Equal(notAfter), check.Equals, true)
+	c.Assert(redirects["late"].NotBefore, check.IsNil)
+	c.Assert(redirects["late"].NotAfter.Equal(notAfter.Add(-time.Hour)), check.Equals, true)
+}
+
+// TestParseRedirectsDestinations tests that destinations are not restricted to http and
+// https URLs, so that existing redirects files to paths and other schemes still load
+func (s *RedirectsTestSuite) TestParseRedirectsDestinations(c *check.C) {
+	redirects := parseRedirects(`
+blog /blog
+mail mailto:jon@example.com
+web https://example.com
+`)
+
+	c.Assert(redirects, check.HasLen, 3)
+	c.Assert(redirects["blog"].URL, check.Equals, "/blog")
+	c.Assert(redirects["mail"].URL, check.Equals, "mailto:jon@example.com")
+}
+
+// TestLookupRedirectTimeBounds tests that redirects are only returned while active, and
+// that expired redirects return ErrRedirectExpired
+func (s *RedirectsTestSuite) TestLookupRedirectTimeBounds(c *check.C) {
+	notBefore := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	server := NewServer(nil, "test")
+	server.redirects = map[string]*Redirect{
+		"promo": {Alias: "promo", URL: "http://promo.com", NotBefore: &notBefore, NotAfter: &notAfter},
+	}
+
+	var tests = []struct {
+		now time.Time
+		url string
+		err error
+	}{
+		{notBefore.Add(-time.Second), "", ErrRedirectNotFound},
+		{notBefore, "http://promo.com", nil},
+		{notAfter.Add(-time.Second), "http://promo.com", nil},
+		{notAfter, "", ErrRedirectExpired},
+		{notAfter.Add(time.Hour), "", ErrRedirectExpired},
+	}
+
+	for _, t := range tests {
+		server.now = func() time.Time { return t.now }
+		url, err := server.LookupRedirect("promo")
+		c.Assert(err, check.Equals, t.err, check.Commentf("at %s", t.now))
+		c.Assert(url, check.Equals, t.url)
+	}
+}
+
+// TestLookupRedirectRefresh tests that the redirects are only refreshed when an alias
+// is not defined, and not when it is defined but inactive, expired or exhausted
+func (s *RedirectsTestSuite) TestLookupRedirectRefresh(c *check.C) {
+	fetches := 0
+	src := readOnlySource(`
+early http://early.com not_before=2026-02-01T00:00:00Z
+late http://late.com not_after=2026-01-01T00:00:00Z
+once http://once.com max_clicks=1
+`)
+	server := NewServerWithSource(nil, countingSource{src, &fetches})
+	server.now = func() time.Time { return time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC) }
+	c.Assert(server.RefreshRedirects(), check.IsNil)
+	c.Assert(server.consumeClick("once"), check.IsNil)
+
+	for _, alias := range []string{"early", "late", "once", "late"} {
+		_, err := server.lookupRedirect(alias)
+		c.Assert(err, check.NotNil, check.Commentf(alias))
+	}
+	c.Assert(fetches, check.Equals, 1)
+
+	_, err := server.lookupRedirect("missing")
+	c.Assert(err, check.Equals, ErrRedirectNotFound)
+	c.Assert(fetches, check.Equals, 2)
+}
+
+// TestParseRedirectsSchedule tests that scheduled destinations are parsed and
+// ordered by the time at which they take effect
+func (s *RedirectsTestSuite) TestParseRedirectsSchedule(c *check.C) {
+	redirects := parseRedirects(`
+talk http://a.com schedule=2026-03-01T00:00:00Z,http://c.com schedule=2026-02-01T00:00:00Z,http://b.com
+bad http://a.com schedule=2026-03-01T00:00:00Z
+dupe http://a.com schedule=2026-03-01T00:00:00Z,http://b.com schedule=2026-03-01T00:00:00Z,http://c.com
+`)
+
+	c.Assert(redirects, check.HasLen, 1)
+	c.Assert(redirects["talk"].Schedule, check.DeepEquals, []ScheduledURL{
+		{At: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), URL: "http://b.com"},
+		{At: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), URL: "http://c.com"},
+	})
+}
+
+// TestLookupRedirectSchedule tests that the destination of a redirect switches
+// automatically as scheduled changes take effect, without a refresh
+func (s *RedirectsTestSuite) TestLookupRedirectSchedule(c *check.C) {
+	feb := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	server := NewServer(nil, "test")
+	server.redirects = map[string]*Redirect{
+		"talk": {Alias: "talk", URL: "http://a.com", Schedule: []ScheduledURL{
+			{At: feb, URL: "http://b.com"},
+			{At: mar, URL: "http://c.com"},
+		}},
+	}
+
+	var tests = []struct {
+		now  time.Time
+		url  string
+		next *ScheduledURL
+	}{
+		{feb.Add(-time.Second), "http://a.com", &ScheduledURL{At: feb, URL: "http://b.com"}},
+		{feb, "http://b.com", &ScheduledURL{At: mar, URL: "http://c.com"}},
+		{mar.Add(time.Hour), "http://c.com", nil},
+	}
+
+	for _, t := range tests {
+		server.now = func() time.Time { return t.now }
+		url, err := server.LookupRedirect("talk")
+		c.Assert(err, check.IsNil)
+		c.Assert(url, check.Equals, t.url)
+		c.Assert(server.redirects["talk"].NextChange(t.now), check.DeepEquals, t.next)
+	}
+}
+
+// TestRedirectString tests that redirects are formatted as lines of a redirects file
+// which parse back to the same redirect
+func (s *RedirectsTestSuite) TestRedirectString(c *check.C) {
+	line := "docs http://docs.com description=Team+docs not_after=2026-02-01T00:00:00Z " +
+		"schedule=2026-01-15T00:00:00Z,http://new.com variant=a,1,http://a.com variant=b,2,http://b.com " +
+		"sticky=true device=android,http://android.com device=ios,http://ios.com lang=de,http://de.com " +
+		"max_clicks=5 hidden=true tags=eng,wiki"
+
+	redirects := parseRedirects(line + "\n")
+	c.Assert(redirects, check.HasLen, 1)
+	c.Assert(redirects["docs"].String(), check.Equals, line)
+
+	c.Assert(parseRedirects(redirects["docs"].String()), check.DeepEquals, redirects)
+	c.Assert((&Redirect{Alias: "foo", URL: "http://foo.bar"}).String(), check.Equals, "foo http://foo.bar")
+}
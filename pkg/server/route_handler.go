@@ -2,10 +2,12 @@ package server
 
 import (
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 
@@ -20,6 +22,21 @@ func (s *Server) routeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Serve the directory of links, if requested.
+	if servedLinks := handleLinks(w, r, s); servedLinks {
+		return
+	}
+
+	// Serve a QR code encoding the short link for an alias, if requested.
+	if servedQR := handleQR(w, r, s); servedQR {
+		return
+	}
+
+	// Render a preview of the redirect rather than following it, if requested.
+	if previewed := handlePreview(w, r, s); previewed {
+		return
+	}
+
 	// First check if there is a redirect defined, and serve it if there is.
 	if redirected := handleRedirect(w, r, s); redirected {
 		return
@@ -38,13 +55,15 @@ func handleFile(w http.ResponseWriter, r *http.Request, s *Server) bool {
 		return false
 	}
 
-	var filepath string
-	if r.URL.Path == "/" {
-		// Serve "index.html" if someone browses to the root
-		filepath = "index.html"
-	} else {
-		filepath = strings.TrimPrefix(r.URL.Path, "/")
-		filepath = strings.TrimSuffix(filepath, "/")
+	filepath := strings.TrimPrefix(r.URL.Path, "/")
+	filepath = strings.TrimSuffix(filepath, "/")
+	if filepath == "" {
+		filepath = "."
+	}
+
+	// Hidden files, and templates overriding the built-in pages, are not content to be served
+	if hidden(filepath) || isTemplateOverride(filepath) {
+		return false
 	}
 
 	// Stat the file and return early if that fails
@@ -53,14 +72,19 @@ func handleFile(w http.ResponseWriter, r *http.Request, s *Server) bool {
 		return false
 	}
 
-	// If the file is a directory, append "index.html" to the end
+	// If the file is a directory, serve its "index.html", or list it if there is none
 	if fi.IsDir() {
-		filepath = fmt.Sprintf("%s/index.html", filepath)
+		index := path.Join(filepath, "index.html")
+		if _, err := fs.Stat(*s.webroot, index); err != nil {
+			return handleListing(w, r, s, filepath)
+		}
+		filepath = index
 	}
 
 	w.Header().Set("Cache-Control", "public, max-age=31536000, must-revalidate")
 	w.Header().Set("ETag", calculateETag(filepath, s.webroot))
 
+	setOutcome(w, outcomeFile)
 	http.ServeFileFS(w, r, *s.webroot, filepath)
 	s.metrics.responseStatus.WithLabelValues(strconv.Itoa(http.StatusOK)).Inc()
 	l.Info("served file", slog.Group("response", "status_code", http.StatusOK, "file", filepath))
@@ -69,48 +93,142 @@ func handleFile(w http.ResponseWriter, r *http.Request, s *Server) bool {
 }
 
 // handleRedirect tries to lookup a redirect by its alias, returning the HTTP 301
-// response if found.
+// response if found. Redirects whose destination can change are served with a 302,
+// so that clients do not cache them.
 func handleRedirect(w http.ResponseWriter, r *http.Request, s *Server) bool {
 	l := logging.GetLoggerFromCtx(r.Context())
 
 	alias := strings.Trim(r.URL.Path, "/")
 
-	url, err := s.LookupRedirect(alias)
-	if err != nil {
+	rd, err := s.lookupRedirect(alias)
+	if errors.Is(err, ErrRedirectExpired) {
+		handleGone(w, r, s)
+		return true
+	} else if err != nil {
 		return false
 	}
 
-	s.metrics.redirectsServed.WithLabelValues(alias).Inc()
-	s.metrics.responseStatus.WithLabelValues(strconv.Itoa(http.StatusMovedPermanently)).Inc()
+	// Password protected redirects render a form until the correct password is given
+	if rd.PasswordHash != "" && !checkPassword(w, r, s, rd) {
+		return true
+	}
+
+	// Limited-use redirects expire once their last click has been consumed. Requests
+	// which should not use a click are shown the preview instead.
+	if rd.MaxClicks > 0 {
+		if !consumesClick(r, rd) {
+			renderPreview(w, r, s, rd)
+			return true
+		}
+		err := s.consumeClick(alias)
+		if errors.Is(err, ErrRedirectExpired) {
+			handleGone(w, r, s)
+			return true
+		} else if err != nil {
+			l.Error("failed to record click", "alias", alias, "error", err.Error())
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			s.metrics.responseStatus.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+			return true
+		}
+	}
+
+	url, variant := s.resolveDestination(w, r, rd)
 
-	rg := slog.Group("response", "location", url, "status_code", http.StatusMovedPermanently)
+	status := http.StatusMovedPermanently
+	if rd.Dynamic() {
+		status = http.StatusFound
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	if r.Method == http.MethodPost {
+		// The destination of a submitted password form must be fetched with a GET
+		status = http.StatusSeeOther
+	}
+	if len(rd.Devices) > 0 {
+		w.Header().Add("Vary", "User-Agent")
+	}
+	if len(rd.Languages) > 0 {
+		w.Header().Add("Vary", "Accept-Language")
+	}
+
+	s.recordHit(alias)
+	s.recordClick(r, alias)
+	if label := s.metrics.aliasLabel(alias); label == otherAlias {
+		s.metrics.redirectsServed.WithLabelValues(otherAlias, "").Inc()
+	} else {
+		s.metrics.redirectsServed.WithLabelValues(label, variant).Inc()
+	}
+	s.metrics.responseStatus.WithLabelValues(strconv.Itoa(status)).Inc()
+
+	rg := slog.Group("response", "location", url, "status_code", status)
+	if variant != "" {
+		rg = slog.Group("response", "location", url, "status_code", status, "variant", variant)
+	}
 	l.Info("served redirect", rg)
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	http.Redirect(w, r, url, http.StatusMovedPermanently)
+	setOutcome(w, outcomeRedirect)
+	http.Redirect(w, r, url, status)
 
 	return true
 }
 
-// handleNotFound handles invalid paths/redirects and returns a 404.html or plaintext "Not found"
+// resolveDestination returns the URL that a request for a redirect should be sent to,
+// along with the name of the variant chosen, if any. Device specific destinations take
+// precedence over language specific destinations, then variants, and finally the
+// scheduled destination.
+func (s *Server) resolveDestination(w http.ResponseWriter, r *http.Request, rd *Redirect) (string, string) {
+	if len(rd.Devices) > 0 {
+		if url, ok := rd.Devices[classifyUserAgent(r.UserAgent())]; ok {
+			return url, ""
+		}
+	}
+
+	if len(rd.Languages) > 0 {
+		if url, ok := matchLanguage(rd.Languages, r.Header.Get("Accept-Language"), s.defaultLanguage); ok {
+			return url, ""
+		}
+	}
+
+	if len(rd.Variants) > 0 {
+		v := s.chooseVariant(w, r, rd)
+		return v.URL, v.Name
+	}
+
+	return rd.Destination(s.now()), ""
+}
+
+// handleNotFound handles invalid paths/redirects and returns the configured not found
+// page, 404.html by default, or plaintext "Not found"
 func handleNotFound(w http.ResponseWriter, r *http.Request, s *Server) {
+	handleErrorPage(w, r, s, http.StatusNotFound, "Not found", s.notFoundPage)
+}
+
+// handleGone handles expired redirects and returns a 410.html or plaintext "Gone"
+func handleGone(w http.ResponseWriter, r *http.Request, s *Server) {
+	handleErrorPage(w, r, s, http.StatusGone, "Gone", "410.html")
+}
+
+// handleErrorPage returns the specified page from the webroot with the given status code,
+// falling back to plaintext if there is no webroot or the page does not exist.
+func handleErrorPage(w http.ResponseWriter, r *http.Request, s *Server, status int, text string, page string) {
 	l := logging.GetLoggerFromCtx(r.Context())
-	s.metrics.responseStatus.WithLabelValues(strconv.Itoa(http.StatusNotFound)).Inc()
+	s.metrics.responseStatus.WithLabelValues(strconv.Itoa(status)).Inc()
+	msg := strings.ToLower(text)
 
-	plainNotFound := func() {
-		http.Error(w, "Not found", http.StatusNotFound)
-		l.Error("not found", slog.Group("response", "status_code", http.StatusNotFound, "text", "Not found"))
+	plainError := func() {
+		http.Error(w, text, status)
+		l.Error(msg, slog.Group("response", "status_code", status, "text", text))
 	}
 
 	if s.webroot == nil {
-		plainNotFound()
+		plainError()
 		return
 	}
 
-	// Check if there is a 404.html to return, otherwise return plaintext
-	content, err := fs.ReadFile(*s.webroot, "404.html")
+	// Check if there is a page to return, otherwise return plaintext
+	content, err := fs.ReadFile(*s.webroot, page)
 	if err != nil {
-		plainNotFound()
+		plainError()
 		return
 	}
 
@@ -118,10 +236,10 @@ func handleNotFound(w http.ResponseWriter, r *http.Request, s *Server) {
 	w.Header().Set("ETag", fmt.Sprintf(`"%d-%x"`, len(content), sha1.Sum(content)))
 	w.Header().Set("Content-Type", "text/html")
 
-	w.WriteHeader(http.StatusNotFound)
+	w.WriteHeader(status)
 	w.Write(content)
 
-	l.Error("not found", slog.Group("response", "status_code", http.StatusNotFound, "file", "404.html"))
+	l.Error(msg, slog.Group("response", "status_code", status, "file", page))
 }
 
 // calculateETag calculates the ETag for a file based on its filename, size and last modified time.
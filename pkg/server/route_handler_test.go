@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"gopkg.in/check.v1"
 )
@@ -30,7 +31,7 @@ var _ = check.Suite(&RouteHandlerTestSuite{})
 
 // requestRoute is a simple helper function that makes a mock request to a given
 // server on a given path, returning the body and status code.
-func requestRoute(s Server, path string) (string, int) {
+func requestRoute(s *Server, path string) (string, int) {
 	// Setup the request and recorder
 	req := httptest.NewRequest("GET", path, nil)
 	rr := httptest.NewRecorder()
@@ -57,20 +58,20 @@ func (s *RouteHandlerTestSuite) TestRouteHandlerSimpleRedirects(c *check.C) {
 	}
 
 	for i, t := range redirectTests {
-		body, code := requestRoute(*s.server, t.urlPath)
+		body, code := requestRoute(s.server, t.urlPath)
 
 		c.Assert(http.StatusMovedPermanently, check.Equals, code)
 		c.Assert(strings.TrimSpace(body), check.Equals, fmt.Sprintf(`<a href="%s">Moved Permanently</a>.`, t.redirect))
 		// Check metrics were incremented properly
 		c.Assert(readCounter(s.server.metrics.requestsTotal), check.Equals, float64(i+1))
-		c.Assert(readCounterVec(*s.server.metrics.redirectsServed, "foo"), check.Equals, float64(1))
+		c.Assert(readCounterVec(*s.server.metrics.redirectsServed, "foo", ""), check.Equals, float64(1))
 	}
 }
 
 // TestRouteHandlerRedirectNotFound tests the request of a non-defined redirect when the
 // webroot is disabled.
 func (s *RouteHandlerTestSuite) TestRouteHandlerRedirectNotFound(c *check.C) {
-	body, code := requestRoute(*s.server, "/undefined")
+	body, code := requestRoute(s.server, "/undefined")
 
 	c.Assert(code, check.Equals, http.StatusNotFound)
 	c.Assert(strings.TrimSpace(body), check.Equals, `Not found`)
@@ -87,7 +88,7 @@ func (s *RouteHandlerTestSuite) TestRouteHandlerRedirectNotFoundRich(c *check.C)
 	fsys := os.DirFS(dir)
 	s.server.webroot = &fsys
 
-	body, code := requestRoute(*s.server, "/undefined")
+	body, code := requestRoute(s.server, "/undefined")
 
 	c.Assert(code, check.Equals, http.StatusNotFound)
 	c.Assert(strings.TrimSpace(body), check.Equals, `<h1>404</h1>`)
@@ -105,14 +106,14 @@ func (s *RouteHandlerTestSuite) TestFileServeOk(c *check.C) {
 	fsys := os.DirFS(dir)
 	s.server.webroot = &fsys
 
-	body, code := requestRoute(*s.server, "/")
+	body, code := requestRoute(s.server, "/")
 
 	c.Assert(code, check.Equals, http.StatusOK)
 	c.Assert(strings.TrimSpace(body), check.Equals, `<h1>Gosherve</h1>`)
 	// Check metrics were incremented properly
 	c.Assert(readCounterVec(*s.server.metrics.responseStatus, "200"), check.Equals, float64(1))
 
-	body, code = requestRoute(*s.server, "/script.js")
+	body, code = requestRoute(s.server, "/script.js")
 
 	c.Assert(code, check.Equals, http.StatusOK)
 	c.Assert(strings.TrimSpace(body), check.Equals, `alert('script')`)
@@ -130,7 +131,7 @@ func (s *RouteHandlerTestSuite) TestDirectoryServeOk(c *check.C) {
 	fsys := os.DirFS(dir)
 	s.server.webroot = &fsys
 
-	body, code := requestRoute(*s.server, "/testDir")
+	body, code := requestRoute(s.server, "/testDir")
 
 	c.Assert(code, check.Equals, http.StatusOK)
 	c.Assert(strings.TrimSpace(body), check.Equals, `<h1>Gosherve</h1>`)
@@ -138,9 +139,33 @@ func (s *RouteHandlerTestSuite) TestDirectoryServeOk(c *check.C) {
 	c.Assert(readCounterVec(*s.server.metrics.responseStatus, "200"), check.Equals, float64(1))
 }
 
+// TestFileServeTemplateOverrides tests that templates overriding the built-in pages are
+// neither served nor listed, so that their source is not revealed
+func (s *RouteHandlerTestSuite) TestFileServeTemplateOverrides(c *check.C) {
+	dir := c.MkDir()
+	os.WriteFile(path.Join(dir, "notes.txt"), []byte("notes"), 0666)
+	for _, name := range templateFiles {
+		os.WriteFile(path.Join(dir, name), []byte("{{/* secret */}}{{ . }}"), 0666)
+	}
+	fsys := os.DirFS(dir)
+	s.server.webroot = &fsys
+	s.server.ConfigureDirectoryListing(true)
+
+	for _, name := range templateFiles {
+		body, code := requestRoute(s.server, "/"+name)
+		c.Assert(code, check.Equals, http.StatusNotFound, check.Commentf(name))
+		c.Assert(body, check.Not(check.Matches), `(?s).*secret.*`)
+	}
+
+	body, code := requestRoute(s.server, "/")
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(body, check.Matches, `(?s).*notes\.txt.*`)
+	c.Assert(body, check.Not(check.Matches), `(?s).*(preview|password|links)\.html.*`)
+}
+
 // TestFileServeNotFound tests a request to a file path where the file is not found
 func (s *RouteHandlerTestSuite) TestFileServeNotFound(c *check.C) {
-	body, code := requestRoute(*s.server, "/")
+	body, code := requestRoute(s.server, "/")
 
 	c.Assert(code, check.Equals, http.StatusNotFound)
 	c.Assert(strings.TrimSpace(body), check.Equals, `Not found`)
@@ -158,7 +183,7 @@ func (s *RouteHandlerTestSuite) TestFileServeCache(c *check.C) {
 	// Request the index page initially
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "/", nil)
-	(*s.server).routeHandler(rr, req)
+	s.server.routeHandler(rr, req)
 
 	// Record the Etag set by the server
 	etag := rr.Header().Get("Etag")
@@ -167,8 +192,34 @@ func (s *RouteHandlerTestSuite) TestFileServeCache(c *check.C) {
 	rr = httptest.NewRecorder()
 	req = httptest.NewRequest("GET", "/", nil)
 	req.Header.Set("If-None-Match", etag)
-	(*s.server).routeHandler(rr, req)
+	s.server.routeHandler(rr, req)
 
 	// Ensure that 304 is returned, not 200
 	c.Assert(rr.Code, check.Equals, http.StatusNotModified)
 }
+
+// TestRouteHandlerRedirectExpired tests that an expired redirect returns a 410, using
+// a 410.html from the webroot if there is one
+func (s *RouteHandlerTestSuite) TestRouteHandlerRedirectExpired(c *check.C) {
+	notAfter := time.Now().Add(-time.Hour)
+	store := NewMemoryStore()
+	store.Put(&Redirect{Alias: "old", URL: "http://old.com", NotAfter: &notAfter})
+	s.server.source = store
+
+	body, code := requestRoute(s.server, "/old")
+
+	c.Assert(code, check.Equals, http.StatusGone)
+	c.Assert(strings.TrimSpace(body), check.Equals, `Gone`)
+	c.Assert(readCounterVec(*s.server.metrics.responseStatus, "410"), check.Equals, float64(1))
+
+	dir := c.MkDir()
+	os.WriteFile(path.Join(dir, "410.html"), []byte("<h1>410</h1>"), 0666)
+	fsys := os.DirFS(dir)
+	s.server.webroot = &fsys
+
+	body, code = requestRoute(s.server, "/old")
+
+	c.Assert(code, check.Equals, http.StatusGone)
+	c.Assert(strings.TrimSpace(body), check.Equals, `<h1>410</h1>`)
+	c.Assert(readCounterVec(*s.server.metrics.responseStatus, "410"), check.Equals, float64(2))
+}
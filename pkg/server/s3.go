@@ -0,0 +1,233 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emptyPayloadHash is the SHA-256 hash of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Credentials are the credentials used to sign requests to an S3-compatible
+// object store. The session token is only required for temporary credentials.
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// S3Source is a read-only RedirectSource that reads a redirects file from an object
+// in an S3-compatible bucket. Requests are signed with AWS Signature Version 4, and
+// the object's ETag is used to avoid downloading and parsing it when unchanged.
+type S3Source struct {
+	mu          sync.Mutex
+	client      *http.Client
+	url         *url.URL
+	region      string
+	credentials S3Credentials
+	etag        string
+	body        []byte
+	redirects   map[string]*Redirect
+	now         func() time.Time
+}
+
+// NewS3Source returns a RedirectSource that reads redirects from the object with the
+// specified key in a bucket. The endpoint is the URL of the object store, such as
+// https://s3.eu-west-1.amazonaws.com, and objects are addressed using path-style URLs.
+func NewS3Source(endpoint string, region string, bucket string, key string, creds S3Credentials) (*S3Source, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint must be an absolute http or https url: %s", endpoint)
+	}
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("s3 bucket and key must not be empty")
+	}
+
+	// Object keys are escaped as required for signing, which is stricter than the
+	// escaping used by net/url
+	u, _ = url.Parse(fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, awsURIEscape(path.Join("/", u.Path, bucket, key))))
+	return &S3Source{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		url:         u,
+		region:      region,
+		credentials: creds,
+		now:         time.Now,
+	}, nil
+}
+
+// Redirects gets the redirects from the object, unless its ETag is unchanged since the
+// last request, in which case the previously parsed redirects are returned.
+func (s *S3Source) Redirects() (map[string]*Redirect, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed, err := s.update()
+	if err != nil {
+		return nil, err
+	}
+	if changed || s.redirects == nil {
+		s.redirects = parseRedirects(string(s.body))
+	}
+	return maps.Clone(s.redirects), nil
+}
+
+// SignedRedirects gets the redirects file from the object, along with the detached
+// signature stored in the object with the same key and a ".sig" suffix, if any.
+func (s *S3Source) SignedRedirects() ([]byte, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.update(); err != nil {
+		return nil, nil, err
+	}
+
+	// The signature is always downloaded, since it may be updated after the redirects
+	sigURL, _ := url.Parse(s.url.String() + signatureSuffix)
+	sig, _, status, err := s.get(sigURL, "")
+	if status == http.StatusNotFound {
+		return s.body, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return s.body, sig, nil
+}
+
+// update gets the redirects object if its ETag has changed since the last request,
+// and reports whether it has changed.
+func (s *S3Source) update() (bool, error) {
+	body, etag, status, err := s.get(s.url, s.etag)
+	if err != nil {
+		return false, err
+	}
+	if status == http.StatusNotModified {
+		return false, nil
+	}
+
+	slog.Debug("fetched redirects from s3", "url", s.url.String(), "etag", etag)
+	s.body, s.etag = body, etag
+	return true, nil
+}
+
+// get makes a signed request for an object, returning its body, ETag and the status
+// of the response. If etag is not empty the request is conditional, and no body is
+// returned if the object's ETag is unchanged.
+func (s *S3Source) get(u *url.URL, etag string) ([]byte, string, int, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	signV4(req, emptyPayloadHash, s.region, "s3", s.credentials, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("error fetching redirects from %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, etag, resp.StatusCode, nil
+	case http.StatusOK:
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, "", resp.StatusCode, fmt.Errorf("error fetching redirects from %s: %s: %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", resp.StatusCode, fmt.Errorf("error reading redirects from %s: %w", u, err)
+	}
+	return body, resp.Header.Get("ETag"), resp.StatusCode, nil
+}
+
+// Version returns the ETag of the object from which the redirects were last read.
+func (s *S3Source) Version() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Trim(s.etag, `"`)
+}
+
+// signV4 signs a request using AWS Signature Version 4, as described at
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv-create-signed-request.html.
+// All headers of the request are signed, so it must not be modified afterwards.
+func signV4(req *http.Request, payloadHash string, region string, service string, creds S3Credentials, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := slices.Sorted(maps.Keys(headers))
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data using the specified key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsURIEscape escapes every byte of a path except unreserved characters and slashes,
+// as required for the canonical URI of a signed request.
+func awsURIEscape(p string) string {
+	var b strings.Builder
+	for _, c := range []byte(p) {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
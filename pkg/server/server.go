@@ -1,40 +1,97 @@
 package server
 
 import (
+	"crypto/ed25519"
+	crand "crypto/rand"
 	"io/fs"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/jnsgruk/gosherve/pkg/analytics"
+	"github.com/jnsgruk/gosherve/pkg/auth"
 	"github.com/jnsgruk/gosherve/pkg/logging"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/text/language"
 )
 
 // Server is responsible for the management of a Gosherve instance.
 // This includes the logger, metrics, configuration and starting the
 // HTTP server.
 type Server struct {
-	redirects       map[string]string
-	redirectsSource string
-	webroot         *fs.FS
-	metrics         *metrics
-	registry        *prometheus.Registry
+	mu               sync.RWMutex
+	writeMu          sync.Mutex
+	redirects        map[string]*Redirect
+	hitsMu           sync.Mutex
+	hits             map[string]uint64
+	clicksMu         sync.Mutex
+	clicks           map[string]int
+	source           RedirectSource
+	version          string
+	refreshInterval  time.Duration
+	webroot          *fs.FS
+	directoryListing bool
+	shortCodes       *shortCodeGenerator
+	qrCodes          *qrCache
+	baseURL          string
+	cookieKey        []byte
+	signingKeys      []ed25519.PublicKey
+	passwordFailures *passwordThrottle
+	tokens           *auth.TokenStore
+	analytics        *analytics.Store
+	now              func() time.Time
+	randInt          func(n int) int
+	notFoundPage     string
+	defaultLanguage  language.Tag
+	metrics          *metrics
+	registry         prometheus.Gatherer
 }
 
-// NewServer returns a newly constructed Server
+// NewServer returns a newly constructed Server which fetches its redirects
+// from the specified url
 func NewServer(webroot *fs.FS, src string) *Server {
+	return NewServerWithSource(webroot, NewURLSource(src))
+}
+
+// NewServerWithSource returns a newly constructed Server which loads its
+// redirects from the specified RedirectSource
+func NewServerWithSource(webroot *fs.FS, src RedirectSource) *Server {
 	reg := prometheus.NewRegistry()
+	return newServer(webroot, src, reg, reg)
+}
+
+// newServer returns a newly constructed Server whose metrics are registered with reg,
+// and served from the gatherer.
+func newServer(webroot *fs.FS, src RedirectSource, reg prometheus.Registerer, gatherer prometheus.Gatherer) *Server {
+	shortCodes, _ := newShortCodeGenerator(DefaultShortCodeLength, DefaultShortCodeAlphabet)
+	cookieKey := make([]byte, 32)
+	crand.Read(cookieKey)
 	return &Server{
-		redirects:       map[string]string{},
-		redirectsSource: src,
-		webroot:         webroot,
-		metrics:         newMetrics(reg),
-		registry:        reg,
+		redirects:        map[string]*Redirect{},
+		hits:             map[string]uint64{},
+		clicks:           map[string]int{},
+		source:           src,
+		webroot:          webroot,
+		shortCodes:       shortCodes,
+		qrCodes:          newQRCache(),
+		cookieKey:        cookieKey,
+		passwordFailures: newPasswordThrottle(),
+		now:              time.Now,
+		randInt:          rand.IntN,
+		notFoundPage:     "404.html",
+		defaultLanguage:  language.English,
+		metrics:          newMetrics(reg),
+		registry:         gatherer,
 	}
 }
 
 // Start is used to start the Gosherve server, listening on port 8080.
-// A metrics server is also started on port 8081.
+// A metrics server is also started on port 8081, and if the redirect
+// source is writable or analytics are enabled, and tokens are configured,
+// an admin API server is started on port 8082.
 func (s *Server) Start() {
 	// Run the metrics handler on a separate HTTP server and different port
 	go func() {
@@ -43,8 +100,65 @@ func (s *Server) Start() {
 		http.ListenAndServe(":8081", nil)
 	}()
 
+	// Run the admin API on a separate HTTP server so it need not be exposed publicly.
+	// The admin API is only started if tokens are configured to protect it.
+	if s.adminEnabled() && s.tokens == nil {
+		slog.Warn("admin server disabled: no token file configured")
+	} else if s.adminEnabled() {
+		go func() {
+			slog.Info("starting admin server", "port", 8082)
+			http.ListenAndServe(":8082", logging.RequestLoggerMiddleware(s.adminHandler()))
+		}()
+	}
+
+	s.startBackground()
+
 	r := http.NewServeMux()
-	r.HandleFunc("/", s.routeHandler)
+	r.HandleFunc("/", s.instrument(s.routeHandler))
 	slog.Info("starting gosherve server", "port", 8080)
 	http.ListenAndServe(":8080", logging.RequestLoggerMiddleware(r))
 }
+
+// startBackground starts polling for redirects, persisting clicks of limited-use
+// redirects and flushing analytics, if configured.
+func (s *Server) startBackground() {
+	if s.refreshInterval > 0 {
+		go s.pollRedirects()
+	}
+	if _, ok := s.source.(RedirectStore); ok {
+		go s.persistClicks()
+	}
+	if s.analytics != nil {
+		go s.flushAnalytics()
+	}
+}
+
+// ConfigureMetricAliases limits the number of aliases which have their own series in
+// the redirects served metric. Aliases in the allowlist always have their own series,
+// and up to max other aliases do, in the order they are first served. Redirects for
+// any other alias are counted under the "other" alias. If max is zero, only
+// aliases in the allowlist have their own series, unless the allowlist is also empty.
+func (s *Server) ConfigureMetricAliases(max int, allowlist []string) {
+	s.metrics.configureAliases(max, allowlist)
+}
+
+// ConfigureNotFoundPage sets the name of the page in the webroot that is returned for
+// requests which match no file or redirect. The default is "404.html".
+func (s *Server) ConfigureNotFoundPage(name string) {
+	s.notFoundPage = name
+}
+
+// ConfigureRefreshInterval sets the interval at which redirects are refreshed from the
+// source, in addition to when an unknown alias is requested. Zero disables polling.
+func (s *Server) ConfigureRefreshInterval(interval time.Duration) {
+	s.refreshInterval = interval
+}
+
+// pollRedirects refreshes the redirects at the configured interval. Errors are logged
+// by RefreshRedirects, and the existing redirects remain in place.
+func (s *Server) pollRedirects() {
+	slog.Info("polling for redirects", "interval", s.refreshInterval.String())
+	for range time.Tick(s.refreshInterval) {
+		s.RefreshRedirects()
+	}
+}
@@ -48,9 +48,17 @@ func readCounter(m prometheus.Counter) float64 {
 }
 
 // readCounterVec is a helper function for reading prometheus CounterVec values
-func readCounterVec(m prometheus.CounterVec, lbl string) float64 {
+func readCounterVec(m prometheus.CounterVec, lbls ...string) float64 {
 	pb := &dto.Metric{}
-	c, _ := m.GetMetricWithLabelValues(lbl)
+	c, _ := m.GetMetricWithLabelValues(lbls...)
 	c.Write(pb)
 	return *pb.GetCounter().Value
 }
+
+// readGaugeVec is a helper function for reading prometheus GaugeVec values
+func readGaugeVec(m *prometheus.GaugeVec, lbls ...string) float64 {
+	pb := &dto.Metric{}
+	g, _ := m.GetMetricWithLabelValues(lbls...)
+	g.Write(pb)
+	return pb.GetGauge().GetValue()
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultShortCodeLength is the default number of characters in a generated short code
+	DefaultShortCodeLength = 6
+	// DefaultShortCodeAlphabet omits characters which are easily confused when read aloud
+	// or printed, such as 0/O and 1/l/I.
+	DefaultShortCodeAlphabet = "23456789abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+	// maxShortCodeAttempts is the number of times generation is retried on collision
+	maxShortCodeAttempts = 10
+)
+
+// ErrShortCodeExhausted is returned when no unused short code could be generated.
+var ErrShortCodeExhausted = errors.New("unable to generate an unused short code")
+
+// shortCodeGenerator generates random aliases for newly shortened URLs.
+type shortCodeGenerator struct {
+	length   int
+	alphabet []rune
+}
+
+// newShortCodeGenerator returns a shortCodeGenerator producing codes of the specified
+// length from the characters in alphabet.
+func newShortCodeGenerator(length int, alphabet string) (*shortCodeGenerator, error) {
+	if length < 1 {
+		return nil, fmt.Errorf("short code length must be at least 1")
+	}
+
+	runes := []rune(alphabet)
+	seen := map[rune]bool{}
+	for _, r := range runes {
+		if r == utf8.RuneError || r == ' ' || r == '/' {
+			return nil, fmt.Errorf("short code alphabet contains invalid character %q", r)
+		}
+		if seen[r] {
+			return nil, fmt.Errorf("short code alphabet contains duplicate character %q", r)
+		}
+		seen[r] = true
+	}
+	if len(runes) < 2 {
+		return nil, fmt.Errorf("short code alphabet must contain at least 2 characters")
+	}
+
+	return &shortCodeGenerator{length: length, alphabet: runes}, nil
+}
+
+// generate returns a random short code for which exists returns false.
+func (g *shortCodeGenerator) generate(exists func(string) bool) (string, error) {
+	max := big.NewInt(int64(len(g.alphabet)))
+	for range maxShortCodeAttempts {
+		code := make([]rune, g.length)
+		for i := range code {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", fmt.Errorf("error generating short code: %w", err)
+			}
+			code[i] = g.alphabet[n.Int64()]
+		}
+		if !exists(string(code)) {
+			return string(code), nil
+		}
+	}
+	return "", ErrShortCodeExhausted
+}
+
+// ConfigureShortCodes sets the length and alphabet used when generating aliases
+// for URLs shortened through the admin API.
+func (s *Server) ConfigureShortCodes(length int, alphabet string) error {
+	g, err := newShortCodeGenerator(length, alphabet)
+	if err != nil {
+		return err
+	}
+	s.shortCodes = g
+	return nil
+}
+
+// shorten returns a redirect for the specified URL. If alias is empty, an existing
+// redirect to the same URL is returned if there is one, otherwise a new alias is
+// generated. The returned bool reports whether a new redirect was created.
+func (s *Server) shorten(url, alias string) (*Redirect, bool, error) {
+	now := s.now()
+
+	if alias != "" {
+		if existing, exists := s.redirect(alias); exists {
+			if existing.URL == url && reusable(existing, now) {
+				return existing, false, nil
+			}
+			return nil, false, errRedirectExists
+		}
+		return &Redirect{Alias: alias, URL: url}, true, nil
+	}
+
+	// Deduplicate by returning the alias that already points to this URL, picking
+	// the first alias alphabetically if there are several.
+	var existing *Redirect
+	s.mu.RLock()
+	for _, r := range s.redirects {
+		if r.URL == url && reusable(r, now) && (existing == nil || r.Alias < existing.Alias) {
+			existing = r
+		}
+	}
+	s.mu.RUnlock()
+	if existing != nil {
+		return existing, false, nil
+	}
+
+	code, err := s.shortCodes.generate(func(code string) bool {
+		if _, exists := s.redirect(code); exists {
+			return true
+		}
+		// Files in the webroot take precedence over redirects, so avoid codes
+		// which would be shadowed by a file.
+		if s.webroot != nil {
+			if _, err := fs.Stat(*s.webroot, code); err == nil {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &Redirect{Alias: code, URL: url}, true, nil
+}
+
+// reusable reports whether an existing redirect can be returned when shortening its URL.
+// Only plain redirects which are active now always send clients to their URL, others
+// may expire, ask for a password or send clients elsewhere.
+func reusable(r *Redirect, now time.Time) bool {
+	return !r.Dynamic() && (r.NotBefore == nil || !now.Before(*r.NotBefore))
+}
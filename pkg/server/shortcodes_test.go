@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/check.v1"
+)
+
+type ShortCodesTestSuite struct {
+	server *Server
+}
+
+func (s *ShortCodesTestSuite) SetUpTest(c *check.C) {
+	store := NewMemoryStore()
+	store.Put(&Redirect{Alias: "foo", URL: "http://foo.bar"})
+	s.server = NewServerWithSource(nil, store)
+	s.server.RefreshRedirects()
+}
+
+var _ = check.Suite(&ShortCodesTestSuite{})
+
+// TestShortCodeGeneratorOptions tests that invalid lengths and alphabets are rejected
+func (s *ShortCodesTestSuite) TestShortCodeGeneratorOptions(c *check.C) {
+	var tests = []struct {
+		length   int
+		alphabet string
+		error    string
+	}{
+		{0, "abc", "short code length must be at least 1"},
+		{4, "a", "short code alphabet must contain at least 2 characters"},
+		{4, "abca", "short code alphabet contains duplicate character 'a'"},
+		{4, "ab/", "short code alphabet contains invalid character '/'"},
+	}
+
+	for _, t := range tests {
+		err := s.server.ConfigureShortCodes(t.length, t.alphabet)
+		c.Assert(err, check.ErrorMatches, t.error)
+	}
+}
+
+// TestShortCodeGenerate tests that generated codes use the configured length and alphabet
+func (s *ShortCodesTestSuite) TestShortCodeGenerate(c *check.C) {
+	g, err := newShortCodeGenerator(8, "xy")
+	c.Assert(err, check.IsNil)
+
+	for range 20 {
+		code, err := g.generate(func(string) bool { return false })
+		c.Assert(err, check.IsNil)
+		c.Assert(code, check.HasLen, 8)
+		c.Assert(strings.Trim(code, "xy"), check.Equals, "")
+	}
+}
+
+// TestShortCodeCollision tests that generation gives up when every code is taken
+func (s *ShortCodesTestSuite) TestShortCodeCollision(c *check.C) {
+	g, _ := newShortCodeGenerator(1, "ab")
+
+	_, err := g.generate(func(string) bool { return true })
+	c.Assert(err, check.Equals, ErrShortCodeExhausted)
+
+	code, err := g.generate(func(code string) bool { return code == "a" })
+	c.Assert(err, check.IsNil)
+	c.Assert(code, check.Equals, "b")
+}
+
+// TestShortCodeAvoidsWebrootFiles tests that codes which would be shadowed by a file
+// in the webroot are not generated
+func (s *ShortCodesTestSuite) TestShortCodeAvoidsWebrootFiles(c *check.C) {
+	dir := c.MkDir()
+	os.WriteFile(path.Join(dir, "a"), []byte("file"), 0666)
+	fsys := os.DirFS(dir)
+	s.server.webroot = &fsys
+	s.server.ConfigureShortCodes(1, "ab")
+
+	for range 10 {
+		rd, created, err := s.server.shorten("http://new", "")
+		c.Assert(err, check.IsNil)
+		c.Assert(created, check.Equals, true)
+		c.Assert(rd.Alias, check.Equals, "b")
+	}
+}
+
+// TestShortenGenerated tests shortening a URL through the admin API
+func (s *ShortCodesTestSuite) TestShortenGenerated(c *check.C) {
+	body, code := requestAdmin(s.server, "POST", "/api/shorten", `{"url":"http://long.url/path"}`)
+	c.Assert(code, check.Equals, http.StatusCreated)
+
+	rd := &Redirect{}
+	c.Assert(json.Unmarshal([]byte(body), rd), check.IsNil)
+	c.Assert(rd.Alias, check.HasLen, DefaultShortCodeLength)
+	c.Assert(rd.URL, check.Equals, "http://long.url/path")
+
+	url, err := s.server.LookupRedirect(rd.Alias)
+	c.Assert(err, check.IsNil)
+	c.Assert(url, check.Equals, "http://long.url/path")
+}
+
+// TestShortenDeduplicates tests that shortening an existing URL returns the existing alias
+func (s *ShortCodesTestSuite) TestShortenDeduplicates(c *check.C) {
+	body, code := requestAdmin(s.server, "POST", "/api/shorten", `{"url":"http://foo.bar"}`)
+	c.Assert(code, check.Equals, http.StatusOK)
+	c.Assert(strings.TrimSpace(body), check.Equals, `{"alias":"foo","url":"http://foo.bar"}`)
+	c.Assert(s.server.NumRedirects(), check.Equals, 1)
+}
+
+// TestShortenSkipsUnusableRedirects tests that shortening a URL does not return existing
+// redirects to it which have expired, are not yet active or are password protected
+func (s *ShortCodesTestSuite) TestShortenSkipsUnusableRedirects(c *check.C) {
+	now := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+
+	s.server.now = func() time.Time { return now }
+	s.server.setRedirect(&Redirect{Alias: "expired", URL: "http://other.url", NotAfter: &past})
+	s.server.setRedirect(&Redirect{Alias: "pending", URL: "http://other.url", NotBefore: &future})
+	s.server.setRedirect(&Redirect{Alias: "protected", URL: "http://other.url", PasswordHash: string(hash)})
+
+	body, code := requestAdmin(s.server, "POST", "/api/shorten", `{"url":"http://other.url"}`)
+	c.Assert(code, check.Equals, http.StatusCreated)
+
+	rd := &Redirect{}
+	c.Assert(json.Unmarshal([]byte(body), rd), check.IsNil)
+	c.Assert(rd.Alias, check.HasLen, DefaultShortCodeLength)
+
+	_, code = requestAdmin(s.server, "POST", "/api/shorten", `{"alias":"protected","url":"http://other.url"}`)
+	c.Assert(code, check.Equals, http.StatusConflict)
+}
+
+// TestShortenVanity tests requesting a specific alias, including conflicting aliases
+func (s *ShortCodesTestSuite) TestShortenVanity(c *check.C) {
+	body, code := requestAdmin(s.server, "POST", "/api/shorten", `{"alias":"mine","url":"http://foo.bar"}`)
+	c.Assert(code, check.Equals, http.StatusCreated)
+	c.Assert(strings.TrimSpace(body), check.Equals, `{"alias":"mine","url":"http://foo.bar"}`)
+
+	_, code = requestAdmin(s.server, "POST", "/api/shorten", `{"alias":"mine","url":"http://foo.bar"}`)
+	c.Assert(code, check.Equals, http.StatusOK)
+
+	body, code = requestAdmin(s.server, "POST", "/api/shorten", `{"alias":"foo","url":"http://other"}`)
+	c.Assert(code, check.Equals, http.StatusConflict)
+	c.Assert(strings.TrimSpace(body), check.Equals, `{"error":"redirect already exists"}`)
+
+	_, code = requestAdmin(s.server, "POST", "/api/shorten", `{"url":""}`)
+	c.Assert(code, check.Equals, http.StatusBadRequest)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/jnsgruk/gosherve/pkg/signing"
+)
+
+// signatureSuffix is appended to the location of a redirects file to find its
+// detached signature.
+const signatureSuffix = ".sig"
+
+// SignedSource is a RedirectSource which can return its redirects file unparsed, along
+// with a detached signature if it has one, so that it can be verified before use.
+type SignedSource interface {
+	RedirectSource
+	SignedRedirects() (body []byte, signature []byte, err error)
+}
+
+// LoadSignedRedirects gets the redirects file from a source and parses it, but only if
+// it is signed by one of the trusted keys. Signatures are read from a detached
+// signature if the source has one, or otherwise from the file's trailer.
+func LoadSignedRedirects(src RedirectSource, keys []ed25519.PublicKey) (map[string]*Redirect, error) {
+	signed, ok := src.(SignedSource)
+	if !ok {
+		return nil, fmt.Errorf("redirect source does not support signatures")
+	}
+
+	body, sig, err := signed.SignedRedirects()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := signing.Verify(body, sig, keys)
+	if err != nil {
+		return nil, err
+	}
+	return parseRedirects(string(content)), nil
+}
+
+// ConfigureSigningKeys requires that redirects are signed by one of the specified
+// keys before they are loaded. Redirects which are unsigned or badly signed are
+// rejected, and the previously loaded redirects are kept.
+func (s *Server) ConfigureSigningKeys(keys []ed25519.PublicKey) error {
+	if _, ok := s.source.(SignedSource); !ok && len(keys) > 0 {
+		return fmt.Errorf("redirect source does not support signatures")
+	}
+	s.signingKeys = keys
+	return nil
+}
+
+// loadRedirects gets the redirects from the server's source, verifying their
+// signature if signing keys are configured.
+func (s *Server) loadRedirects() (map[string]*Redirect, error) {
+	if len(s.signingKeys) == 0 {
+		return s.source.Redirects()
+	}
+
+	redirects, err := LoadSignedRedirects(s.source, s.signingKeys)
+	if err != nil {
+		s.metrics.redirectsRejected.Inc()
+		return nil, err
+	}
+	return redirects, nil
+}
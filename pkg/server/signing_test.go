@@ -0,0 +1,153 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/jnsgruk/gosherve/pkg/signing"
+	"gopkg.in/check.v1"
+)
+
+type SigningTestSuite struct {
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+	mu      sync.Mutex
+	files   map[string]string
+	server  *httptest.Server
+}
+
+var _ = check.Suite(&SigningTestSuite{})
+
+func (s *SigningTestSuite) SetUpTest(c *check.C) {
+	public, private, err := signing.GenerateKey()
+	c.Assert(err, check.IsNil)
+	s.public, s.private = public, private
+
+	s.files = map[string]string{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		content, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+}
+
+func (s *SigningTestSuite) TearDownTest(c *check.C) {
+	s.server.Close()
+}
+
+// serve sets the content of a file served by the test server, removing it if empty
+func (s *SigningTestSuite) serve(name string, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if content == "" {
+		delete(s.files, name)
+	} else {
+		s.files[name] = content
+	}
+}
+
+// TestDetachedSignature tests that redirects with a valid detached signature are
+// loaded, and that tampered or unsigned redirects are rejected, keeping the old map
+func (s *SigningTestSuite) TestDetachedSignature(c *check.C) {
+	body := "foo http://foo.bar\n"
+	s.serve("/redirects", body)
+	s.serve("/redirects.sig", signing.Sign([]byte(body), s.private))
+
+	server := NewServerWithSource(nil, NewURLSource(s.server.URL+"/redirects"))
+	c.Assert(server.ConfigureSigningKeys([]ed25519.PublicKey{s.public}), check.IsNil)
+	c.Assert(server.RefreshRedirects(), check.IsNil)
+	c.Assert(server.NumRedirects(), check.Equals, 1)
+
+	s.serve("/redirects", "foo http://evil.com\nbar http://evil.com\n")
+	c.Assert(server.RefreshRedirects(), check.NotNil)
+	url, err := server.LookupRedirect("foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(url, check.Equals, "http://foo.bar")
+	c.Assert(readCounter(server.metrics.redirectsRejected), check.Equals, float64(1))
+
+	s.serve("/redirects.sig", "")
+	c.Assert(server.RefreshRedirects(), check.NotNil)
+	c.Assert(server.NumRedirects(), check.Equals, 1)
+	c.Assert(readCounter(server.metrics.redirectsRejected), check.Equals, float64(2))
+}
+
+// TestTrailerSignature tests that redirects can be signed with an embedded trailer
+func (s *SigningTestSuite) TestTrailerSignature(c *check.C) {
+	s.serve("/redirects", string(signing.AppendTrailer([]byte("foo http://foo.bar\nbar http://bar.baz\n"), s.private)))
+
+	server := NewServerWithSource(nil, NewURLSource(s.server.URL+"/redirects"))
+	c.Assert(server.ConfigureSigningKeys([]ed25519.PublicKey{s.public}), check.IsNil)
+	c.Assert(server.RefreshRedirects(), check.IsNil)
+	c.Assert(server.NumRedirects(), check.Equals, 2)
+
+	// Signatures from untrusted keys are rejected
+	_, other, err := signing.GenerateKey()
+	c.Assert(err, check.IsNil)
+	s.serve("/redirects", string(signing.AppendTrailer([]byte("foo http://evil.com\n"), other)))
+	c.Assert(server.RefreshRedirects(), check.NotNil)
+	c.Assert(server.NumRedirects(), check.Equals, 2)
+}
+
+// TestSignedGitSource tests that detached signatures are read from the same commit
+// as the redirects in a git repository
+func (s *SigningTestSuite) TestSignedGitSource(c *check.C) {
+	dir := c.MkDir()
+	repo, err := git.PlainInit(dir, false)
+	c.Assert(err, check.IsNil)
+
+	body := []byte("foo http://foo.bar\n")
+	c.Assert(os.WriteFile(path.Join(dir, "redirects"), body, 0644), check.IsNil)
+	c.Assert(os.WriteFile(path.Join(dir, "redirects.sig"), []byte(signing.Sign(body, s.private)), 0644), check.IsNil)
+	wt, err := repo.Worktree()
+	c.Assert(err, check.IsNil)
+	_, err = wt.Add(".")
+	c.Assert(err, check.IsNil)
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	_, err = wt.Commit("add redirects", &git.CommitOptions{Author: sig})
+	c.Assert(err, check.IsNil)
+
+	src, err := NewGitSource(dir, "", "redirects")
+	c.Assert(err, check.IsNil)
+	redirects, err := LoadSignedRedirects(src, []ed25519.PublicKey{s.public})
+	c.Assert(err, check.IsNil)
+	c.Assert(redirects, check.HasLen, 1)
+}
+
+// TestSignedS3Source tests that detached signatures are read from S3 objects
+func (s *SigningTestSuite) TestSignedS3Source(c *check.C) {
+	s3 := newFakeS3()
+	defer s3.Close()
+
+	body := "foo http://foo.bar\n"
+	s3.put("/config/redirects", body)
+	src, err := NewS3Source(s3.URL, "us-east-1", "config", "redirects", testS3Credentials)
+	c.Assert(err, check.IsNil)
+
+	_, err = LoadSignedRedirects(src, []ed25519.PublicKey{s.public})
+	c.Assert(err, check.Equals, signing.ErrUnsigned)
+
+	s3.put("/config/redirects.sig", signing.Sign([]byte(body), s.private))
+	redirects, err := LoadSignedRedirects(src, []ed25519.PublicKey{s.public})
+	c.Assert(err, check.IsNil)
+	c.Assert(redirects, check.HasLen, 1)
+}
+
+// TestUnsupportedSource tests that signing keys cannot be configured for sources
+// which cannot be signed, such as stores managed through the admin API
+func (s *SigningTestSuite) TestUnsupportedSource(c *check.C) {
+	server := NewServerWithSource(nil, NewMemoryStore())
+	c.Assert(server.ConfigureSigningKeys([]ed25519.PublicKey{s.public}), check.ErrorMatches, "redirect source does not support signatures")
+	c.Assert(server.ConfigureSigningKeys(nil), check.IsNil)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RedirectSource is implemented by anything that can provide gosherve with
+// a complete map of redirects, keyed by alias.
+type RedirectSource interface {
+	Redirects() (map[string]*Redirect, error)
+}
+
+// RedirectStore is a RedirectSource which can also be modified. Servers that
+// are configured with a RedirectStore expose the admin API.
+type RedirectStore interface {
+	RedirectSource
+	Put(redirects ...*Redirect) error
+	Delete(alias string) error
+}
+
+// URLSource is a read-only RedirectSource that fetches a redirects file over HTTP.
+type URLSource struct {
+	url string
+}
+
+// NewURLSource returns a RedirectSource that fetches redirects from the specified url
+func NewURLSource(url string) *URLSource {
+	return &URLSource{url: url}
+}
+
+// Redirects gets the latest redirects from the specified url
+func (u *URLSource) Redirects() (map[string]*Redirect, error) {
+	body, _, err := u.fetch(u.url)
+	if err != nil {
+		return nil, err
+	}
+	return parseRedirects(string(body)), nil
+}
+
+// SignedRedirects gets the latest redirects file from the specified url, along with
+// the detached signature at the same url with a ".sig" suffix, if any.
+func (u *URLSource) SignedRedirects() ([]byte, []byte, error) {
+	body, _, err := u.fetch(u.url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sig, status, err := u.fetch(u.url + signatureSuffix)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case status == http.StatusNotFound:
+		return body, nil, nil
+	case status != http.StatusOK:
+		return nil, nil, fmt.Errorf("error fetching signature from %s: %d", u.url+signatureSuffix, status)
+	}
+	return body, sig, nil
+}
+
+// fetch gets the body and status code of the response from the specified url
+func (u *URLSource) fetch(url string) ([]byte, int, error) {
+	// Add a query param to the URL to break caching if required (Github Gists!)
+	reqURL := fmt.Sprintf("%s?cachebust=%d", url, time.Now().Unix())
+
+	resp, err := http.Get(reqURL)
+	slog.Debug("fetched redirects specification", "url", reqURL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching redirects from %s", reqURL)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading redirect gist")
+	}
+	return body, resp.StatusCode, nil
+}
+
+// MemoryStore is a RedirectStore that holds redirects in memory only.
+type MemoryStore struct {
+	mu        sync.Mutex
+	redirects map[string]*Redirect
+}
+
+// NewMemoryStore returns an empty in-memory RedirectStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{redirects: map[string]*Redirect{}}
+}
+
+// Redirects returns a copy of the redirects held in the store
+func (m *MemoryStore) Redirects() (map[string]*Redirect, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.redirects), nil
+}
+
+// Put adds or replaces redirects in the store
+func (m *MemoryStore) Put(redirects ...*Redirect) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range redirects {
+		m.redirects[r.Alias] = r
+	}
+	return nil
+}
+
+// Delete removes a redirect from the store
+func (m *MemoryStore) Delete(alias string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.redirects[alias]; !exists {
+		return ErrRedirectNotFound
+	}
+	delete(m.redirects, alias)
+	return nil
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// renameFile is used to atomically replace the store file; it is a variable so
+// that tests can simulate a crash before the rename takes place.
+var renameFile = os.Rename
+
+// fileStoreDocument is the on-disk representation of a FileStore.
+type fileStoreDocument struct {
+	Redirects []*Redirect `json:"redirects"`
+}
+
+// FileStore is a RedirectStore that persists redirects to a single JSON document
+// on the local filesystem. Each write is made to a temporary file which is synced
+// and then renamed over the previous document, so that a crash at any point leaves
+// either the old or the new document in place, but never a partial one.
+type FileStore struct {
+	mu        sync.Mutex
+	path      string
+	redirects map[string]*Redirect
+}
+
+// NewFileStore returns a FileStore backed by the file at the specified path. If the
+// file does not exist it is created when the first redirect is written.
+func NewFileStore(path string) (*FileStore, error) {
+	f := &FileStore{path: path, redirects: map[string]*Redirect{}}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading redirect store: %w", err)
+	}
+
+	doc := fileStoreDocument{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing redirect store %s: %w", path, err)
+	}
+
+	for _, r := range doc.Redirects {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid redirect '%s' in store %s: %w", r.Alias, path, err)
+		}
+		f.redirects[r.Alias] = r
+	}
+
+	return f, nil
+}
+
+// Redirects returns a copy of the redirects held in the store
+func (f *FileStore) Redirects() (map[string]*Redirect, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return maps.Clone(f.redirects), nil
+}
+
+// Put adds or replaces redirects and persists the store with a single write
+func (f *FileStore) Put(redirects ...*Redirect) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	updated := maps.Clone(f.redirects)
+	for _, r := range redirects {
+		updated[r.Alias] = r
+	}
+
+	if err := f.write(updated); err != nil {
+		return err
+	}
+	f.redirects = updated
+	return nil
+}
+
+// Delete removes a redirect and persists the store
+func (f *FileStore) Delete(alias string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.redirects[alias]; !exists {
+		return ErrRedirectNotFound
+	}
+
+	redirects := maps.Clone(f.redirects)
+	delete(redirects, alias)
+
+	if err := f.write(redirects); err != nil {
+		return err
+	}
+	f.redirects = redirects
+	return nil
+}
+
+// write atomically replaces the store document with the specified redirects.
+func (f *FileStore) write(redirects map[string]*Redirect) error {
+	doc := fileStoreDocument{Redirects: slices.SortedFunc(maps.Values(redirects), func(a, b *Redirect) int {
+		return strings.Compare(a.Alias, b.Alias)
+	})}
+
+	content, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding redirect store: %w", err)
+	}
+
+	dir := filepath.Dir(f.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary redirect store: %w", err)
+	}
+	// Clean up the temporary file if anything below fails; after a successful
+	// rename this is a no-op.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing redirect store: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing redirect store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing redirect store: %w", err)
+	}
+
+	if err := renameFile(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("error replacing redirect store: %w", err)
+	}
+
+	// Sync the directory so that the rename itself is durable.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path"
+
+	"gopkg.in/check.v1"
+)
+
+type FileStoreTestSuite struct {
+	path string
+}
+
+func (s *FileStoreTestSuite) SetUpTest(c *check.C) {
+	s.path = path.Join(c.MkDir(), "redirects.json")
+}
+
+func (s *FileStoreTestSuite) TearDownTest(c *check.C) {
+	renameFile = os.Rename
+}
+
+var _ = check.Suite(&FileStoreTestSuite{})
+
+// TestFileStoreEmpty tests that a store can be opened where no file exists yet
+func (s *FileStoreTestSuite) TestFileStoreEmpty(c *check.C) {
+	store, err := NewFileStore(s.path)
+	c.Assert(err, check.IsNil)
+
+	redirects, err := store.Redirects()
+	c.Assert(err, check.IsNil)
+	c.Assert(redirects, check.DeepEquals, map[string]*Redirect{})
+}
+
+// TestFileStorePersists tests that writes survive the store being reopened
+func (s *FileStoreTestSuite) TestFileStorePersists(c *check.C) {
+	store, _ := NewFileStore(s.path)
+	c.Assert(store.Put(&Redirect{Alias: "foo", URL: "http://foo.bar"}), check.IsNil)
+	c.Assert(store.Put(&Redirect{Alias: "bar", URL: "http://bar.baz"}), check.IsNil)
+	c.Assert(store.Delete("foo"), check.IsNil)
+
+	reopened, err := NewFileStore(s.path)
+	c.Assert(err, check.IsNil)
+
+	redirects, _ := reopened.Redirects()
+	c.Assert(redirects, check.DeepEquals, map[string]*Redirect{
+		"bar": {Alias: "bar", URL: "http://bar.baz"},
+	})
+}
+
+// TestFileStoreDeleteMissing tests that deleting an unknown alias returns ErrRedirectNotFound
+func (s *FileStoreTestSuite) TestFileStoreDeleteMissing(c *check.C) {
+	store, _ := NewFileStore(s.path)
+	c.Assert(store.Delete("foo"), check.Equals, ErrRedirectNotFound)
+}
+
+// TestFileStoreCrashBeforeRename simulates a crash after the temporary file is written
+// but before it replaces the store, ensuring the previous document is kept intact.
+func (s *FileStoreTestSuite) TestFileStoreCrashBeforeRename(c *check.C) {
+	store, _ := NewFileStore(s.path)
+	c.Assert(store.Put(&Redirect{Alias: "foo", URL: "http://foo.bar"}), check.IsNil)
+
+	renameFile = func(oldpath, newpath string) error { return errors.New("crash") }
+	err := store.Put(&Redirect{Alias: "bar", URL: "http://bar.baz"})
+	c.Assert(err, check.ErrorMatches, "error replacing redirect store: crash")
+
+	// The in-memory state should not reflect the failed write
+	redirects, _ := store.Redirects()
+	c.Assert(redirects, check.HasLen, 1)
+
+	// And the document on disk should be the previous version
+	reopened, err := NewFileStore(s.path)
+	c.Assert(err, check.IsNil)
+	redirects, _ = reopened.Redirects()
+	c.Assert(redirects, check.DeepEquals, map[string]*Redirect{
+		"foo": {Alias: "foo", URL: "http://foo.bar"},
+	})
+
+	// No temporary files should be left behind
+	entries, _ := os.ReadDir(path.Dir(s.path))
+	c.Assert(entries, check.HasLen, 1)
+}
+
+// TestFileStoreIgnoresPartialTempFile tests that a partially written temporary file left
+// over from a crash does not affect loading the store.
+func (s *FileStoreTestSuite) TestFileStoreIgnoresPartialTempFile(c *check.C) {
+	store, _ := NewFileStore(s.path)
+	c.Assert(store.Put(&Redirect{Alias: "foo", URL: "http://foo.bar"}), check.IsNil)
+
+	os.WriteFile(s.path+".123.tmp", []byte(`{"redirects": [{"alias": "ba`), 0600)
+
+	reopened, err := NewFileStore(s.path)
+	c.Assert(err, check.IsNil)
+	redirects, _ := reopened.Redirects()
+	c.Assert(redirects, check.HasLen, 1)
+}
+
+// TestFileStoreCorrupt tests that a corrupt or invalid store is reported rather than
+// silently replaced with an empty one.
+func (s *FileStoreTestSuite) TestFileStoreCorrupt(c *check.C) {
+	os.WriteFile(s.path, []byte(`{"redirects": [`), 0600)
+	_, err := NewFileStore(s.path)
+	c.Assert(err, check.ErrorMatches, "error parsing redirect store .*")
+
+	os.WriteFile(s.path, []byte(`{"redirects": [{"alias": "foo", "url": ""}]}`), 0600)
+	_, err = NewFileStore(s.path)
+	c.Assert(err, check.ErrorMatches, "invalid redirect 'foo' in store .*: url must not be empty")
+}
+
+// TestFileStoreAsSource tests that a server can be hydrated from a FileStore
+func (s *FileStoreTestSuite) TestFileStoreAsSource(c *check.C) {
+	store, _ := NewFileStore(s.path)
+	store.Put(&Redirect{Alias: "foo", URL: "http://foo.bar"})
+
+	server := NewServerWithSource(nil, store)
+	c.Assert(server.RefreshRedirects(), check.IsNil)
+
+	url, err := server.LookupRedirect("foo")
+	c.Assert(err, check.IsNil)
+	c.Assert(url, check.Equals, "http://foo.bar")
+}
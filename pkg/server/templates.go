@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+
+	"github.com/jnsgruk/gosherve/pkg/logging"
+)
+
+//go:embed templates/*.html
+var defaultTemplates embed.FS
+
+// templateFiles are the names of the built-in templates, which may be overridden by
+// files of the same name at the root of the webroot.
+var templateFiles = []string{previewTemplateFile, passwordTemplateFile, linksTemplateFile, listingTemplateFile}
+
+// isTemplateOverride reports whether a path in the webroot overrides a built-in template.
+// Such files are never served or listed, since they would reveal the template source.
+func isTemplateOverride(name string) bool {
+	return slices.Contains(templateFiles, name)
+}
+
+// templateFuncs are available to all templates, including those in the webroot.
+var templateFuncs = template.FuncMap{"isWebURL": isWebURL}
+
+// template returns the named template from the webroot if there is one, otherwise
+// the built-in template of the same name.
+func (s *Server) template(name string) (*template.Template, error) {
+	if s.webroot != nil {
+		if content, err := fs.ReadFile(*s.webroot, name); err == nil {
+			return template.New(name).Funcs(templateFuncs).Parse(string(content))
+		}
+	}
+	return template.New(name).Funcs(templateFuncs).ParseFS(defaultTemplates, path.Join("templates", name))
+}
+
+// renderTemplate renders the named template with the given status code, reporting whether
+// it was successful. Pages rendered from templates describe individual redirects, so must
+// not be cached.
+func renderTemplate(w http.ResponseWriter, r *http.Request, s *Server, status int, name string, data any) bool {
+	l := logging.GetLoggerFromCtx(r.Context())
+
+	var buf bytes.Buffer
+	tmpl, err := s.template(name)
+	if err == nil {
+		err = tmpl.Execute(&buf, data)
+	}
+	if err != nil {
+		l.Error("failed to render template", "template", name, "error", err.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		s.metrics.responseStatus.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		return false
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+
+	s.metrics.responseStatus.WithLabelValues(strconv.Itoa(status)).Inc()
+	return true
+}
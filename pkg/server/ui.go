@@ -0,0 +1,17 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the embedded web admin UI, which manages redirects using
+// the admin API.
+func (s *Server) uiHandler() http.Handler {
+	ui, _ := fs.Sub(uiFiles, "ui")
+	return http.FileServerFS(ui)
+}
@@ -0,0 +1,172 @@
+"use strict";
+
+// The token is kept for the lifetime of the browser tab only.
+const tokenKey = "gosherve-token";
+
+let redirects = [];
+let hits = {};
+
+const $ = (id) => document.getElementById(id);
+
+// api makes an authenticated request to the admin API, returning the decoded
+// JSON body, or throwing an Error with the message returned by the server.
+async function api(method, path, body) {
+  const res = await fetch(path, {
+    method,
+    headers: {
+      Authorization: `Bearer ${sessionStorage.getItem(tokenKey)}`,
+      "Content-Type": "application/json",
+    },
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+
+  if (res.status === 204) {
+    return null;
+  }
+
+  const text = await res.text();
+  if (!res.ok) {
+    let message = text.trim();
+    try {
+      message = JSON.parse(text).error;
+    } catch {}
+    throw new Error(`${res.status}: ${message}`);
+  }
+  return JSON.parse(text);
+}
+
+function showMessage(text, isError) {
+  $("message").textContent = text;
+  $("message").className = isError ? "error" : "";
+}
+
+// run invokes an async action, reporting any error to the user.
+async function run(action) {
+  try {
+    await action();
+  } catch (err) {
+    showMessage(err.message, true);
+  }
+}
+
+async function load() {
+  [redirects, hits] = await Promise.all([
+    api("GET", "/api/redirects"),
+    api("GET", "/api/hits"),
+  ]);
+  $("links").hidden = false;
+  $("sign-out").hidden = false;
+  render();
+}
+
+// isWebURL reports whether a destination is an http or https URL, so that other
+// schemes, such as javascript:, are never rendered as links.
+function isWebURL(url) {
+  try {
+    return ["http:", "https:"].includes(new URL(url).protocol);
+  } catch {
+    return false;
+  }
+}
+
+function render() {
+  const query = $("search").value.trim().toLowerCase();
+  const tbody = $("redirects");
+  tbody.replaceChildren();
+
+  for (const r of redirects) {
+    if (query && !r.alias.toLowerCase().includes(query) && !r.url.toLowerCase().includes(query)) {
+      continue;
+    }
+
+    const row = tbody.insertRow();
+    row.insertCell().textContent = r.alias;
+
+    // Scheduled redirects report their current destination separately
+    const url = r.current_url || r.url;
+    const cell = row.insertCell();
+    if (isWebURL(url)) {
+      const link = document.createElement("a");
+      link.href = url;
+      link.textContent = url;
+      link.rel = "noreferrer";
+      cell.append(link);
+    } else {
+      cell.textContent = url;
+    }
+    if (r.next) {
+      const next = document.createElement("small");
+      next.textContent = ` (${r.next.url} from ${new Date(r.next.at).toLocaleString()})`;
+      cell.append(next);
+    }
+
+    const count = row.insertCell();
+    count.className = "hits";
+    count.textContent = hits[r.alias] || 0;
+
+    const actions = row.insertCell();
+    actions.className = "actions";
+    actions.append(
+      button("Edit", () => editRedirect(r)),
+      button("Delete", () => deleteRedirect(r)),
+    );
+  }
+}
+
+function button(label, onClick) {
+  const b = document.createElement("button");
+  b.type = "button";
+  b.textContent = label;
+  b.addEventListener("click", () => run(onClick));
+  return b;
+}
+
+async function editRedirect(r) {
+  const url = prompt(`New URL for ${r.alias}`, r.url);
+  if (url === null || url === r.url) {
+    return;
+  }
+  // Only the URL is sent, so that the server keeps the other attributes as they are
+  await api("PUT", `/api/redirects/${encodeURIComponent(r.alias)}`, { url });
+  showMessage(`Updated ${r.alias}`);
+  await load();
+}
+
+async function deleteRedirect(r) {
+  if (!confirm(`Delete ${r.alias}?`)) {
+    return;
+  }
+  await api("DELETE", `/api/redirects/${encodeURIComponent(r.alias)}`);
+  showMessage(`Deleted ${r.alias}`);
+  await load();
+}
+
+$("token-form").addEventListener("submit", (e) => {
+  e.preventDefault();
+  sessionStorage.setItem(tokenKey, $("token").value);
+  $("token").value = "";
+  run(load);
+});
+
+$("sign-out").addEventListener("click", () => {
+  sessionStorage.removeItem(tokenKey);
+  location.reload();
+});
+
+$("add-form").addEventListener("submit", (e) => {
+  e.preventDefault();
+  run(async () => {
+    const alias = $("add-alias").value.trim();
+    const url = $("add-url").value.trim();
+    await api("POST", "/api/redirects", { alias, url });
+    $("add-form").reset();
+    showMessage(`Added ${alias}`);
+    await load();
+  });
+});
+
+$("search").addEventListener("input", render);
+
+if (sessionStorage.getItem(tokenKey)) {
+  run(load);
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Device classes that a User-Agent can be classified as.
+const (
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+)
+
+// deviceClasses is the list of all valid device classes.
+var deviceClasses = []string{DeviceIOS, DeviceAndroid, DeviceDesktop, DeviceBot}
+
+// botSignatures are lowercase substrings which identify crawlers, link preview
+// fetchers and other automated clients.
+var botSignatures = []string{
+	"crawler", "spider", "slurp", "facebookexternalhit", "facebookcatalog",
+	"whatsapp", "embedly", "quora link preview", "vkshare", "skypeuripreview",
+	"mediapartners-google", "adsbot-google", "feedfetcher", "lighthouse", "telegrambot",
+}
+
+// botToken matches "bot" as a word of its own, or at the end of a product name such as
+// "Googlebot/2.1" or "Slackbot-LinkExpanding". It is not matched anywhere else, since
+// device names such as CUBOT and words such as "robotics" also contain "bot".
+var botToken = regexp.MustCompile(`\bbot\b|bot[/-]`)
+
+// classifyUserAgent returns the device class of a User-Agent string. Bots are
+// detected first, since some crawlers also identify as mobile devices.
+func classifyUserAgent(ua string) string {
+	lower := strings.ToLower(ua)
+
+	if botToken.MatchString(lower) || slices.ContainsFunc(botSignatures, func(sig string) bool { return strings.Contains(lower, sig) }) {
+		return DeviceBot
+	}
+
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "iPod"):
+		return DeviceIOS
+	case strings.Contains(ua, "Android"):
+		return DeviceAndroid
+	default:
+		return DeviceDesktop
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+)
+
+type UserAgentTestSuite struct{}
+
+var _ = check.Suite(&UserAgentTestSuite{})
+
+// TestClassifyUserAgent tests the device classification of real User-Agent strings
+func (s *UserAgentTestSuite) TestClassifyUserAgent(c *check.C) {
+	var tests = []struct {
+		ua     string
+		device string
+	}{
+		// iOS
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", DeviceIOS},
+		{"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1", DeviceIOS},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/123.0.6312.52 Mobile/15E148 Safari/604.1", DeviceIOS},
+		{"Mozilla/5.0 (iPod touch; CPU iPhone OS 12_5_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.1.2 Mobile/15E148 Safari/604.1", DeviceIOS},
+		// Android
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.6312.80 Mobile Safari/537.36", DeviceAndroid},
+		{"Mozilla/5.0 (Linux; Android 13; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36", DeviceAndroid},
+		{"Mozilla/5.0 (Android 14; Mobile; rv:124.0) Gecko/124.0 Firefox/124.0", DeviceAndroid},
+		{"Mozilla/5.0 (Linux; Android 12; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36", DeviceAndroid},
+		// Handsets whose names contain "bot" are not bots
+		{"Mozilla/5.0 (Linux; Android 10; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Mobile Safari/537.36", DeviceAndroid},
+		{"Mozilla/5.0 (Linux; Android 11; CUBOT_NOTE_20) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Mobile Safari/537.36", DeviceAndroid},
+		// Desktop
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36", DeviceDesktop},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15", DeviceDesktop},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:124.0) Gecko/20100101 Firefox/124.0", DeviceDesktop},
+		{"RoboticsLab-Kiosk/1.0 (Windows NT 10.0)", DeviceDesktop},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36 Edg/123.0.2420.65", DeviceDesktop},
+		{"curl/8.6.0", DeviceDesktop},
+		{"", DeviceDesktop},
+		// Bots, including those which identify as mobile devices
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", DeviceBot},
+		{"Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.6312.86 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", DeviceBot},
+		{"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", DeviceBot},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1 (Applebot/0.1; +http://www.apple.com/go/applebot)", DeviceBot},
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", DeviceBot},
+		{"Twitterbot/1.0", DeviceBot},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", DeviceBot},
+		{"WhatsApp/2.23.20.0", DeviceBot},
+		{"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", DeviceBot},
+		{"Mozilla/5.0 (compatible; YandexBot/3.0; +http://yandex.com/bots)", DeviceBot},
+		{"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)", DeviceBot},
+		{"TelegramBot (like TwitterBot)", DeviceBot},
+		{"Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)", DeviceBot},
+	}
+
+	for _, t := range tests {
+		c.Assert(classifyUserAgent(t.ua), check.Equals, t.device, check.Commentf("%s", t.ua))
+	}
+}
+
+// TestParseDevices tests that device specific destinations are parsed and validated
+func (s *UserAgentTestSuite) TestParseDevices(c *check.C) {
+	redirects := parseRedirects(`
+app https://example.com/app device=ios,https://apps.apple.com/app/id1 device=android,https://play.google.com/store/apps/details?id=com.example
+badclass https://example.com/app device=windows,https://microsoft.com
+badurl https://example.com/app device=ios,
+`)
+
+	c.Assert(redirects, check.HasLen, 1)
+	c.Assert(redirects["app"].Devices, check.DeepEquals, map[string]string{
+		"ios":     "https://apps.apple.com/app/id1",
+		"android": "https://play.google.com/store/apps/details?id=com.example",
+	})
+}
+
+// TestRouteHandlerDevices tests that requests are redirected according to their device class,
+// falling back to the redirect URL for devices without a specific destination
+func (s *UserAgentTestSuite) TestRouteHandlerDevices(c *check.C) {
+	store := NewMemoryStore()
+	store.Put(&Redirect{Alias: "app", URL: "https://example.com/app", Devices: map[string]string{
+		DeviceIOS:     "https://apps.apple.com/app/id1",
+		DeviceAndroid: "https://play.google.com/store/apps/details?id=com.example",
+	}})
+	server := NewServerWithSource(nil, store)
+
+	var tests = []struct {
+		ua       string
+		location string
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", "https://apps.apple.com/app/id1"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.6312.80 Mobile Safari/537.36", "https://play.google.com/store/apps/details?id=com.example"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:124.0) Gecko/20100101 Firefox/124.0", "https://example.com/app"},
+		{"Twitterbot/1.0", "https://example.com/app"},
+	}
+
+	for _, t := range tests {
+		req := httptest.NewRequest("GET", "/app", nil)
+		req.Header.Set("User-Agent", t.ua)
+		rr := httptest.NewRecorder()
+		server.routeHandler(rr, req)
+
+		c.Assert(rr.Code, check.Equals, http.StatusFound)
+		c.Assert(rr.Header().Get("Location"), check.Equals, t.location)
+		c.Assert(rr.Header().Get("Vary"), check.Equals, "User-Agent")
+	}
+}
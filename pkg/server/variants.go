@@ -0,0 +1,113 @@
+package server
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// variantCookieMaxAge is how long a sticky variant is remembered by the client.
+const variantCookieMaxAge = 30 * 24 * time.Hour
+
+// Variant is one of several weighted destinations for a redirect, used to split
+// traffic between destinations for A/B testing.
+type Variant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// parseVariant parses a variant specified as <name>,<weight>,<url>.
+func parseVariant(value string) (Variant, error) {
+	parts := strings.SplitN(value, ",", 3)
+	if len(parts) != 3 {
+		return Variant{}, fmt.Errorf("invalid variant: %s", value)
+	}
+	weight, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Variant{}, fmt.Errorf("invalid weight for variant: %s", parts[1])
+	}
+	return Variant{Name: parts[0], Weight: weight, URL: parts[2]}, nil
+}
+
+// validateVariants checks that variants have unique names, positive weights and valid URLs.
+func validateVariants(variants []Variant) error {
+	names := map[string]bool{}
+	for _, v := range variants {
+		if v.Name == "" {
+			return fmt.Errorf("variant name must not be empty")
+		}
+		if strings.IndexFunc(v.Name, invalidNameRune) >= 0 {
+			return fmt.Errorf("variant name '%s' may only contain letters, digits, '-' and '_'", v.Name)
+		}
+		if names[v.Name] {
+			return fmt.Errorf("duplicate variant name '%s'", v.Name)
+		}
+		names[v.Name] = true
+
+		if v.Weight < 1 {
+			return fmt.Errorf("variant '%s' must have a positive weight", v.Name)
+		}
+		if err := validateURL(v.URL); err != nil {
+			return fmt.Errorf("variant '%s': %w", v.Name, err)
+		}
+	}
+	return nil
+}
+
+// invalidNameRune reports whether a rune may not be used in a variant name or tag.
+// Names are restricted so that they can be used as cookie values, metric labels and
+// query parameters.
+func invalidNameRune(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+}
+
+// chooseVariant picks one of a redirect's variants at random according to their
+// weights. If the redirect is sticky and the request carries a cookie naming one of
+// its variants, that variant is chosen again, otherwise the cookie is set.
+func (s *Server) chooseVariant(w http.ResponseWriter, r *http.Request, rd *Redirect) Variant {
+	// Aliases may contain characters which are not valid in cookie names
+	sum := sha256.Sum256([]byte(rd.Alias))
+	cookieName := fmt.Sprintf("gosherve-variant-%x", sum[:4])
+
+	if rd.Sticky {
+		if c, err := r.Cookie(cookieName); err == nil {
+			for _, v := range rd.Variants {
+				if v.Name == c.Value {
+					return v
+				}
+			}
+		}
+	}
+
+	total := 0
+	for _, v := range rd.Variants {
+		total += v.Weight
+	}
+
+	chosen := rd.Variants[len(rd.Variants)-1]
+	n := s.randInt(total)
+	for _, v := range rd.Variants {
+		if n < v.Weight {
+			chosen = v
+			break
+		}
+		n -= v.Weight
+	}
+
+	if rd.Sticky {
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookieName,
+			Value:    chosen.Name,
+			Path:     "/" + rd.Alias,
+			MaxAge:   int(variantCookieMaxAge.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	return chosen
+}
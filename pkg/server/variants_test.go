@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+)
+
+type VariantsTestSuite struct {
+	server *Server
+}
+
+func (s *VariantsTestSuite) SetUpTest(c *check.C) {
+	store := NewMemoryStore()
+	store.Put(&Redirect{Alias: "ab", URL: "http://default.com", Variants: []Variant{
+		{Name: "a", URL: "http://a.com", Weight: 1},
+		{Name: "b", URL: "http://b.com", Weight: 3},
+	}})
+	s.server = NewServerWithSource(nil, store)
+	s.server.RefreshRedirects()
+}
+
+var _ = check.Suite(&VariantsTestSuite{})
+
+// TestParseVariants tests that variants are parsed from redirect attributes
+func (s *VariantsTestSuite) TestParseVariants(c *check.C) {
+	redirects := parseRedirects(`
+ab http://default.com variant=a,1,http://a.com variant=b,3,http://b.com?x=1,2 sticky=true
+noweight http://default.com variant=a,http://a.com
+zero http://default.com variant=a,0,http://a.com
+dupe http://default.com variant=a,1,http://a.com variant=a,1,http://b.com
+badname http://default.com variant=a;b,1,http://a.com
+`)
+
+	c.Assert(redirects, check.HasLen, 1)
+	c.Assert(redirects["ab"].Sticky, check.Equals, true)
+	c.Assert(redirects["ab"].Variants, check.DeepEquals, []Variant{
+		{Name: "a", URL: "http://a.com", Weight: 1},
+		{Name: "b", URL: "http://b.com?x=1,2", Weight: 3},
+	})
+}
+
+// TestChooseVariantWeights tests that variants are chosen in proportion to their weights
+func (s *VariantsTestSuite) TestChooseVariantWeights(c *check.C) {
+	rd, _ := s.server.redirect("ab")
+
+	var tests = []struct {
+		n       int
+		variant string
+	}{
+		{0, "a"}, {1, "b"}, {2, "b"}, {3, "b"},
+	}
+
+	for _, t := range tests {
+		s.server.randInt = func(total int) int {
+			c.Assert(total, check.Equals, 4)
+			return t.n
+		}
+		v := s.server.chooseVariant(httptest.NewRecorder(), httptest.NewRequest("GET", "/ab", nil), rd)
+		c.Assert(v.Name, check.Equals, t.variant)
+	}
+}
+
+// TestRouteHandlerVariant tests that split redirects are served with a 302 and counted
+// per variant
+func (s *VariantsTestSuite) TestRouteHandlerVariant(c *check.C) {
+	s.server.randInt = func(int) int { return 0 }
+
+	rr := httptest.NewRecorder()
+	s.server.routeHandler(rr, httptest.NewRequest("GET", "/ab", nil))
+
+	c.Assert(rr.Code, check.Equals, http.StatusFound)
+	c.Assert(rr.Header().Get("Location"), check.Equals, "http://a.com")
+	c.Assert(rr.Header().Get("Cache-Control"), check.Equals, "no-store")
+	c.Assert(rr.Result().Cookies(), check.HasLen, 0)
+	c.Assert(readCounterVec(*s.server.metrics.redirectsServed, "ab", "a"), check.Equals, float64(1))
+	c.Assert(readCounterVec(*s.server.metrics.redirectsServed, "ab", "b"), check.Equals, float64(0))
+}
+
+// TestRouteHandlerStickyVariant tests that sticky redirects set a cookie, and that the
+// variant in the cookie is chosen on subsequent requests
+func (s *VariantsTestSuite) TestRouteHandlerStickyVariant(c *check.C) {
+	rd, _ := s.server.redirect("ab")
+	sticky := *rd
+	sticky.Sticky = true
+	s.server.setRedirect(&sticky)
+
+	s.server.randInt = func(int) int { return 3 }
+	rr := httptest.NewRecorder()
+	s.server.routeHandler(rr, httptest.NewRequest("GET", "/ab", nil))
+
+	c.Assert(rr.Header().Get("Location"), check.Equals, "http://b.com")
+	cookies := rr.Result().Cookies()
+	c.Assert(cookies, check.HasLen, 1)
+	c.Assert(cookies[0].Value, check.Equals, "b")
+	c.Assert(cookies[0].Path, check.Equals, "/ab")
+
+	// Subsequent requests with the cookie get the same variant, whatever the dice say
+	s.server.randInt = func(int) int { return 0 }
+	for range 3 {
+		req := httptest.NewRequest("GET", "/ab", nil)
+		req.AddCookie(cookies[0])
+		rr = httptest.NewRecorder()
+		s.server.routeHandler(rr, req)
+		c.Assert(rr.Header().Get("Location"), check.Equals, "http://b.com")
+	}
+
+	// Unless the variant in the cookie no longer exists
+	req := httptest.NewRequest("GET", "/ab", nil)
+	req.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: "removed"})
+	rr = httptest.NewRecorder()
+	s.server.routeHandler(rr, req)
+	c.Assert(rr.Header().Get("Location"), check.Equals, "http://a.com")
+}
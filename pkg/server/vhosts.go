@@ -0,0 +1,173 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jnsgruk/gosherve/pkg/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultHost is the host pattern which matches requests for any host not matched by
+// another pattern.
+const DefaultHost = "*"
+
+// VirtualHosts routes requests to one of several Servers according to the Host header,
+// so that a single process can serve several domains. Each host has its own webroot,
+// redirects and configuration, and its metrics are labelled with its host pattern.
+// The metrics of each host are kept in their own registry, so that the admin API of
+// one host does not expose those of another.
+type VirtualHosts struct {
+	hosts      map[string]*Server
+	registries prometheus.Gatherers
+}
+
+// NewVirtualHosts returns an empty set of virtual hosts
+func NewVirtualHosts() *VirtualHosts {
+	return &VirtualHosts{hosts: map[string]*Server{}}
+}
+
+// AddHost returns a new Server which serves requests for hosts matching the pattern.
+// Patterns are either a hostname, a wildcard such as "*.example.com" which matches any
+// subdomain of example.com, or DefaultHost. Exact hostnames take precedence over
+// wildcards, and longer wildcards over shorter ones.
+func (v *VirtualHosts) AddHost(pattern string, webroot *fs.FS, src RedirectSource) (*Server, error) {
+	pattern = strings.ToLower(pattern)
+	if err := validateHostPattern(pattern); err != nil {
+		return nil, err
+	}
+	if _, exists := v.hosts[pattern]; exists {
+		return nil, fmt.Errorf("duplicate host '%s'", pattern)
+	}
+
+	registry := prometheus.NewRegistry()
+	reg := prometheus.WrapRegistererWith(prometheus.Labels{"host": pattern}, registry)
+	s := newServer(webroot, src, reg, registry)
+	v.hosts[pattern] = s
+	v.registries = append(v.registries, registry)
+	return s, nil
+}
+
+// validateHostPattern checks that a host pattern is a hostname, optionally with a
+// leading wildcard label, or DefaultHost.
+func validateHostPattern(pattern string) error {
+	if pattern == DefaultHost {
+		return nil
+	}
+	host := strings.TrimPrefix(pattern, "*.")
+	if host == "" || strings.ContainsAny(host, "*:/ ") || strings.HasPrefix(host, ".") || strings.HasSuffix(host, ".") {
+		return fmt.Errorf("invalid host '%s'", pattern)
+	}
+	return nil
+}
+
+// match returns the Server for a request's Host header, along with the pattern which
+// matched it.
+func (v *VirtualHosts) match(host string) (*Server, string, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if s, ok := v.hosts[host]; ok {
+		return s, host, true
+	}
+
+	// Try wildcards for each parent domain, from the most specific
+	for rest := host; strings.Contains(rest, "."); {
+		_, rest, _ = strings.Cut(rest, ".")
+		if s, ok := v.hosts["*."+rest]; ok {
+			return s, "*." + rest, true
+		}
+	}
+
+	s, ok := v.hosts[DefaultHost]
+	return s, DefaultHost, ok
+}
+
+// ServeHTTP serves a request using the Server for its host, or returns a 404 if no
+// host matches.
+func (v *VirtualHosts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s, pattern, ok := v.match(r.Host)
+	l := logging.GetLoggerFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		l.Error("unknown host", slog.Group("response", "status_code", http.StatusNotFound, "host", r.Host))
+		return
+	}
+
+	ctx := logging.WithLogger(r.Context(), l.With("host", pattern))
+	s.instrument(s.routeHandler)(w, r.WithContext(ctx))
+}
+
+// RefreshRedirects refreshes the redirects of every host, returning an error if any
+// of them fail.
+func (v *VirtualHosts) RefreshRedirects() error {
+	for pattern, s := range v.hosts {
+		if err := s.RefreshRedirects(); err != nil {
+			return fmt.Errorf("host '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// adminHandler returns the handler for the admin API, which is routed to the host's
+// Server in the same way as other requests. Hosts which have no writable source or
+// analytics, or which have no tokens configured, do not serve the admin API. Each host
+// checks tokens against its own token store, and serves only its own metrics.
+func (v *VirtualHosts) adminHandler() http.Handler {
+	handlers := map[*Server]http.Handler{}
+	for pattern, s := range v.hosts {
+		if !s.adminEnabled() {
+			continue
+		}
+		if s.tokens == nil {
+			slog.Warn("admin server disabled: no token file configured", "host", pattern)
+			continue
+		}
+		handlers[s] = s.adminHandler()
+	}
+	if len(handlers) == 0 {
+		return nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, _, _ := v.match(r.Host)
+		h, ok := handlers[s]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Start is used to start serving all of the virtual hosts on port 8080, with the
+// metrics of every host served on port 8081. If any host serves the admin API, an
+// admin API server is started on port 8082.
+func (v *VirtualHosts) Start() {
+	go func() {
+		http.Handle("/metrics", promhttp.HandlerFor(v.registries, promhttp.HandlerOpts{}))
+		slog.Info("starting metrics server", "port", 8081)
+		http.ListenAndServe(":8081", nil)
+	}()
+
+	if admin := v.adminHandler(); admin != nil {
+		go func() {
+			slog.Info("starting admin server", "port", 8082)
+			http.ListenAndServe(":8082", logging.RequestLoggerMiddleware(admin))
+		}()
+	}
+
+	for _, s := range v.hosts {
+		s.startBackground()
+	}
+
+	slog.Info("starting gosherve server", "port", 8080, "hosts", len(v.hosts))
+	http.ListenAndServe(":8080", logging.RequestLoggerMiddleware(v))
+}
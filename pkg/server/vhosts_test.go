@@ -0,0 +1,204 @@
+package server
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing/fstest"
+
+	"github.com/jnsgruk/gosherve/pkg/auth"
+	"gopkg.in/check.v1"
+)
+
+type VirtualHostsTestSuite struct {
+	vhosts *VirtualHosts
+}
+
+var _ = check.Suite(&VirtualHostsTestSuite{})
+
+// addHost adds a host to the suite's virtual hosts with a single redirect from the
+// alias "foo" to url
+func (s *VirtualHostsTestSuite) addHost(c *check.C, pattern string, webroot fs.FS, url string) *Server {
+	store := NewMemoryStore()
+	store.Put(&Redirect{Alias: "foo", URL: url})
+
+	var root *fs.FS
+	if webroot != nil {
+		root = &webroot
+	}
+	server, err := s.vhosts.AddHost(pattern, root, store)
+	c.Assert(err, check.IsNil)
+	return server
+}
+
+// request makes a request for path to the suite's virtual hosts with the specified
+// Host header
+func (s *VirtualHostsTestSuite) request(host string, path string) *http.Response {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Host = host
+	rr := httptest.NewRecorder()
+	s.vhosts.ServeHTTP(rr, req)
+	return rr.Result()
+}
+
+func (s *VirtualHostsTestSuite) SetUpTest(c *check.C) {
+	s.vhosts = NewVirtualHosts()
+	s.addHost(c, "jnsgr.uk", nil, "http://exact.com")
+	s.addHost(c, "*.example.com", nil, "http://wildcard.com")
+	s.addHost(c, "*.docs.example.com", nil, "http://docs.com")
+	c.Assert(s.vhosts.RefreshRedirects(), check.IsNil)
+}
+
+// TestVirtualHostsRouting tests that requests are routed by exact hostname, then the
+// most specific wildcard
+func (s *VirtualHostsTestSuite) TestVirtualHostsRouting(c *check.C) {
+	tests := []struct {
+		host     string
+		location string
+	}{
+		{"jnsgr.uk", "http://exact.com"},
+		{"JNSGR.UK:8080", "http://exact.com"},
+		{"jnsgr.uk.", "http://exact.com"},
+		{"a.example.com", "http://wildcard.com"},
+		{"a.b.example.com", "http://wildcard.com"},
+		{"a.docs.example.com", "http://docs.com"},
+	}
+
+	for _, t := range tests {
+		res := s.request(t.host, "/foo")
+		c.Assert(res.StatusCode, check.Equals, http.StatusMovedPermanently, check.Commentf(t.host))
+		c.Assert(res.Header.Get("Location"), check.Equals, t.location, check.Commentf(t.host))
+	}
+
+	// Wildcards do not match the domain itself, and unknown hosts are not found
+	for _, host := range []string{"example.com", "other.com", ""} {
+		c.Assert(s.request(host, "/foo").StatusCode, check.Equals, http.StatusNotFound, check.Commentf(host))
+	}
+}
+
+// TestVirtualHostsDefault tests that the default host serves requests for hosts that
+// match no other pattern
+func (s *VirtualHostsTestSuite) TestVirtualHostsDefault(c *check.C) {
+	s.addHost(c, DefaultHost, nil, "http://default.com")
+	c.Assert(s.vhosts.RefreshRedirects(), check.IsNil)
+
+	res := s.request("other.com", "/foo")
+	c.Assert(res.Header.Get("Location"), check.Equals, "http://default.com")
+	res = s.request("jnsgr.uk", "/foo")
+	c.Assert(res.Header.Get("Location"), check.Equals, "http://exact.com")
+}
+
+// TestVirtualHostsWebroots tests that each host serves files and its not found page
+// from its own webroot
+func (s *VirtualHostsTestSuite) TestVirtualHostsWebroots(c *check.C) {
+	server := s.addHost(c, "files.com", fstest.MapFS{
+		"index.html":   {Data: []byte("files home")},
+		"missing.html": {Data: []byte("files missing")},
+	}, "http://files.com")
+	server.ConfigureNotFoundPage("missing.html")
+	s.addHost(c, "other.com", fstest.MapFS{"index.html": {Data: []byte("other home")}}, "http://other.com")
+
+	res := s.request("files.com", "/")
+	body, _ := io.ReadAll(res.Body)
+	c.Assert(string(body), check.Equals, "files home")
+
+	res = s.request("other.com", "/")
+	body, _ = io.ReadAll(res.Body)
+	c.Assert(string(body), check.Equals, "other home")
+
+	res = s.request("files.com", "/nope")
+	body, _ = io.ReadAll(res.Body)
+	c.Assert(res.StatusCode, check.Equals, http.StatusNotFound)
+	c.Assert(string(body), check.Equals, "files missing")
+}
+
+// TestVirtualHostsMetrics tests that the metrics of each host are labelled with its
+// host pattern
+func (s *VirtualHostsTestSuite) TestVirtualHostsMetrics(c *check.C) {
+	s.request("jnsgr.uk", "/foo")
+	s.request("a.example.com", "/foo")
+	s.request("b.example.com", "/foo")
+
+	families, err := s.vhosts.registries.Gather()
+	c.Assert(err, check.IsNil)
+
+	requests := map[string]float64{}
+	for _, f := range families {
+		if f.GetName() != "gosherve_requests_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "host" {
+					requests[l.GetValue()] = m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	c.Assert(requests, check.DeepEquals, map[string]float64{"jnsgr.uk": 1, "*.example.com": 2, "*.docs.example.com": 0})
+}
+
+// TestVirtualHostsAdmin tests that the admin API is routed to the host's server
+func (s *VirtualHostsTestSuite) TestVirtualHostsAdmin(c *check.C) {
+	// Hosts without tokens do not serve the admin API
+	c.Assert(s.vhosts.adminHandler(), check.IsNil)
+
+	tokens, _ := auth.NewTokenStore(path.Join(c.MkDir(), "tokens.json"))
+	plaintext, _, _ := tokens.Mint("reader", []auth.Scope{auth.ScopeLinksRead})
+	s.vhosts.hosts["*.docs.example.com"].ConfigureTokens(tokens)
+
+	handler := s.vhosts.adminHandler()
+	c.Assert(handler, check.NotNil)
+
+	req := httptest.NewRequest("GET", "/api/redirects/foo", nil)
+	req.Header.Set("Authorization", "Bearer "+plaintext)
+	req.Host = "a.docs.example.com"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	c.Assert(rr.Code, check.Equals, http.StatusOK)
+	c.Assert(rr.Body.String(), check.Matches, `(?s).*"url":"http://docs.com".*`)
+
+	req.Host = "jnsgr.uk"
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	c.Assert(rr.Code, check.Equals, http.StatusNotFound)
+}
+
+// TestVirtualHostsAdminIsolation tests that tokens and metrics are not shared between
+// hosts with their own token stores
+func (s *VirtualHostsTestSuite) TestVirtualHostsAdminIsolation(c *check.C) {
+	docsTokens, _ := auth.NewTokenStore(path.Join(c.MkDir(), "tokens.json"))
+	docsToken, _, _ := docsTokens.Mint("docs", []auth.Scope{auth.ScopeLinksRead, auth.ScopeMetrics})
+	s.vhosts.hosts["*.docs.example.com"].ConfigureTokens(docsTokens)
+	exactTokens, _ := auth.NewTokenStore(path.Join(c.MkDir(), "tokens.json"))
+	s.vhosts.hosts["jnsgr.uk"].ConfigureTokens(exactTokens)
+	s.request("jnsgr.uk", "/foo")
+
+	handler := s.vhosts.adminHandler()
+	request := func(host string, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+docsToken)
+		req.Host = host
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	c.Assert(request("a.docs.example.com", "/api/redirects/foo").Code, check.Equals, http.StatusOK)
+	c.Assert(request("jnsgr.uk", "/api/redirects/foo").Code, check.Equals, http.StatusUnauthorized)
+
+	rr := request("a.docs.example.com", "/metrics")
+	c.Assert(rr.Code, check.Equals, http.StatusOK)
+	c.Assert(rr.Body.String(), check.Matches, `(?s).*gosherve_requests_total\{host="\*\.docs\.example\.com"\} 0.*`)
+	c.Assert(rr.Body.String(), check.Not(check.Matches), `(?s).*jnsgr\.uk.*`)
+}
+
+// TestVirtualHostsInvalid tests that invalid and duplicate host patterns are rejected
+func (s *VirtualHostsTestSuite) TestVirtualHostsInvalid(c *check.C) {
+	for _, pattern := range []string{"", "*.", "a.*.com", "foo.com:8080", ".foo.com", "Jnsgr.uk"} {
+		_, err := s.vhosts.AddHost(pattern, nil, NewMemoryStore())
+		c.Assert(err, check.NotNil, check.Commentf(pattern))
+	}
+}
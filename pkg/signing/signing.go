@@ -0,0 +1,128 @@
+// Package signing signs and verifies redirects files using ed25519, so that gosherve
+// can refuse to load redirects which have been tampered with at their source.
+//
+// A signature is either detached, and stored alongside the redirects file, or embedded
+// as a trailer on the last line of the file. Keys and signatures are base64 encoded.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TrailerPrefix begins the line which embeds a signature in a redirects file. The
+// signature covers everything in the file before the trailer.
+const TrailerPrefix = "# gosherve-signature: "
+
+var (
+	ErrUnsigned     = errors.New("redirects are not signed")
+	ErrBadSignature = errors.New("signature is not valid for any trusted key")
+)
+
+// GenerateKey returns a new key pair for signing redirects.
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(nil)
+}
+
+// EncodePublicKey returns the base64 encoding of a public key.
+func EncodePublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// ParsePublicKey parses a base64 encoded public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: %s", s)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// ParsePublicKeys parses a comma separated list of base64 encoded public keys.
+func ParsePublicKeys(s string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, k := range strings.Split(s, ",") {
+		if strings.TrimSpace(k) == "" {
+			continue
+		}
+		key, err := ParsePublicKey(k)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// EncodePrivateKey returns the base64 encoding of a private key's seed.
+func EncodePrivateKey(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Seed())
+}
+
+// ParsePrivateKey parses a private key from the base64 encoding of its seed.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	return ed25519.NewKeyFromSeed(b), nil
+}
+
+// Sign returns the base64 encoded detached signature of a redirects file.
+func Sign(body []byte, key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, body))
+}
+
+// AppendTrailer returns a copy of a redirects file with its signature embedded as a
+// trailer. Any existing trailer is replaced.
+func AppendTrailer(body []byte, key ed25519.PrivateKey) []byte {
+	content, _, _ := SplitTrailer(body)
+	content = bytes.Clone(content)
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+	return fmt.Appendf(content, "%s%s\n", TrailerPrefix, Sign(content, key))
+}
+
+// SplitTrailer separates a redirects file into its content and the signature in its
+// trailer, if it has one. Blank lines following the trailer are ignored.
+func SplitTrailer(body []byte) (content []byte, signature []byte, ok bool) {
+	trimmed := bytes.TrimRight(body, " \t\r\n")
+	start := bytes.LastIndexByte(trimmed, '\n') + 1
+
+	sig, ok := bytes.CutPrefix(trimmed[start:], []byte(TrailerPrefix))
+	if !ok {
+		return body, nil, false
+	}
+	return body[:start], sig, true
+}
+
+// Verify checks the signature of a redirects file against a set of trusted keys,
+// returning the signed content. If the detached signature is nil, the signature is
+// read from the file's trailer, and the trailer is removed from the content.
+func Verify(body []byte, detached []byte, keys []ed25519.PublicKey) ([]byte, error) {
+	content, signature := body, detached
+	if detached == nil {
+		var ok bool
+		content, signature, ok = SplitTrailer(body)
+		if !ok {
+			return nil, ErrUnsigned
+		}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: malformed signature", ErrBadSignature)
+	}
+
+	for _, key := range keys {
+		if ed25519.Verify(key, content, sig) {
+			return content, nil
+		}
+	}
+	return nil, ErrBadSignature
+}
@@ -0,0 +1,95 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type SigningTestSuite struct {
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+var _ = check.Suite(&SigningTestSuite{})
+
+func (s *SigningTestSuite) SetUpTest(c *check.C) {
+	public, private, err := GenerateKey()
+	c.Assert(err, check.IsNil)
+	s.public, s.private = public, private
+}
+
+// TestDetachedSignature tests that a detached signature verifies the whole file, and
+// that any change to the file is detected
+func (s *SigningTestSuite) TestDetachedSignature(c *check.C) {
+	body := []byte("foo http://foo.bar\n")
+	sig := []byte(Sign(body, s.private) + "\n")
+
+	content, err := Verify(body, sig, []ed25519.PublicKey{s.public})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(content), check.Equals, string(body))
+
+	_, err = Verify([]byte("foo http://evil.com\n"), sig, []ed25519.PublicKey{s.public})
+	c.Assert(err, check.Equals, ErrBadSignature)
+
+	_, err = Verify(body, []byte("not a signature"), []ed25519.PublicKey{s.public})
+	c.Assert(err, check.ErrorMatches, ".*malformed signature")
+}
+
+// TestTrailer tests that signatures can be embedded in and verified from a trailer,
+// which is removed from the verified content
+func (s *SigningTestSuite) TestTrailer(c *check.C) {
+	signed := AppendTrailer([]byte("foo http://foo.bar"), s.private)
+
+	content, err := Verify(signed, nil, []ed25519.PublicKey{s.public})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(content), check.Equals, "foo http://foo.bar\n")
+
+	// Signing again replaces the existing trailer
+	c.Assert(string(AppendTrailer(signed, s.private)), check.Equals, string(signed))
+
+	// Trailing blank lines are ignored
+	_, err = Verify(append(signed, "\n\n"...), nil, []ed25519.PublicKey{s.public})
+	c.Assert(err, check.IsNil)
+
+	tampered := append([]byte("bar http://evil.com\n"), signed...)
+	_, err = Verify(tampered, nil, []ed25519.PublicKey{s.public})
+	c.Assert(err, check.Equals, ErrBadSignature)
+
+	_, err = Verify([]byte("foo http://foo.bar\n"), nil, []ed25519.PublicKey{s.public})
+	c.Assert(err, check.Equals, ErrUnsigned)
+}
+
+// TestKeyRotation tests that a signature is accepted if it matches any trusted key
+func (s *SigningTestSuite) TestKeyRotation(c *check.C) {
+	other, _, err := GenerateKey()
+	c.Assert(err, check.IsNil)
+
+	body := []byte("foo http://foo.bar\n")
+	sig := []byte(Sign(body, s.private))
+
+	_, err = Verify(body, sig, []ed25519.PublicKey{other})
+	c.Assert(err, check.Equals, ErrBadSignature)
+	_, err = Verify(body, sig, []ed25519.PublicKey{other, s.public})
+	c.Assert(err, check.IsNil)
+}
+
+// TestKeyEncoding tests that keys can be encoded and parsed
+func (s *SigningTestSuite) TestKeyEncoding(c *check.C) {
+	private, err := ParsePrivateKey(EncodePrivateKey(s.private))
+	c.Assert(err, check.IsNil)
+	c.Assert(private.Equal(s.private), check.Equals, true)
+
+	keys, err := ParsePublicKeys(EncodePublicKey(s.public) + ", " + EncodePublicKey(s.public))
+	c.Assert(err, check.IsNil)
+	c.Assert(keys, check.HasLen, 2)
+	c.Assert(keys[0].Equal(s.public), check.Equals, true)
+
+	_, err = ParsePublicKeys("Zm9v")
+	c.Assert(err, check.ErrorMatches, "invalid public key: Zm9v")
+	_, err = ParsePrivateKey("Zm9v")
+	c.Assert(err, check.ErrorMatches, "invalid private key")
+}